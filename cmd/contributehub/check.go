@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/segflow/contribuehub/pkg/ast"
+	"github.com/segflow/contribuehub/pkg/checker"
+	"github.com/segflow/contribuehub/pkg/codechange"
+	"github.com/segflow/contribuehub/pkg/config"
+	"github.com/segflow/contribuehub/pkg/log"
+	"github.com/segflow/contribuehub/pkg/sarif"
+	"github.com/spf13/cobra"
+)
+
+// checkOptions are the flags shared by the commands running checkers.
+type checkOptions struct {
+	checkers []string
+	mode     string
+	exclude  []string
+	tags     []string
+	tests    bool
+	format   string
+	context  int
+}
+
+var opts checkOptions
+
+func (o *checkOptions) addFlags(cmd *cobra.Command) {
+	flags := cmd.PersistentFlags()
+	flags.StringSliceVar(&o.checkers, "checkers", nil, "checkers to run, checkers.enabled of the configuration by default, see the checkers command")
+	flags.StringVar(&o.mode, "mode", "", "which functions the channel direction checker may change: all, internal or unexported. "+
+		"Defaults to all for local directories, and to internal for GitHub repositories to keep the API of importable packages")
+	flags.StringSliceVar(&o.exclude, "exclude", nil, "patterns of files which must not be changed, e.g. '*.pb.go'")
+	flags.StringSliceVar(&o.tags, "tags", nil, "additional build tags")
+	flags.BoolVar(&o.tests, "tests", false, "check test files too")
+	flags.StringVar(&o.format, "format", "text", "output format of the changes: text, json or sarif")
+	flags.IntVar(&o.context, "context", codechange.DefaultContext, "number of context lines of diffs")
+}
+
+// analysis runs checkers on the packages of a directory.
+type analysis struct {
+	checkers []checker.Info
+	options  checker.Options
+	load     ast.LoadConfig
+}
+
+// analysis returns the analysis configured by cfg, overridden by the flags. defaultMode is the channel direction
+// mode used unless set by the configuration or the --mode flag.
+func (o *checkOptions) analysis(cmd *cobra.Command, cfg *config.Config, defaultMode checker.ChanDirectionMode) (*analysis, error) {
+	flags := cmd.Flags()
+	names, exclude, tags, tests := cfg.Checkers.Enabled, cfg.Checkers.Exclude, cfg.Checkers.Tags, cfg.Checkers.Tests
+	if flags.Changed("checkers") {
+		names = o.checkers
+	}
+	if flags.Changed("exclude") {
+		exclude = o.exclude
+	}
+	if flags.Changed("tags") {
+		tags = o.tags
+	}
+	if flags.Changed("tests") {
+		tests = o.tests
+	}
+
+	checkers, err := checker.Select(names)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := defaultMode
+	modeName := cfg.Checkers.ChanDir.Mode
+	if flags.Changed("mode") {
+		modeName = o.mode
+	}
+	if modeName != "" {
+		mode, err = checker.ParseChanDirectionMode(modeName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &analysis{
+		checkers: checkers,
+		options:  checker.Options{ChanDirectionMode: mode},
+		load: ast.LoadConfig{
+			Exclude: exclude,
+			Tags:    tags,
+			Tests:   tests,
+		},
+	}, nil
+}
+
+// run loads the packages in dir and returns the changes of the checkers, by file.
+// Once ctx is done, the loading and the checkers are interrupted and the error is ctx's.
+func (a *analysis) run(ctx context.Context, dir string) (map[string][]codechange.CodeChange, error) {
+	logger := log.FromContext(ctx)
+	fset := token.NewFileSet()
+	load := a.load
+	load.Context = ctx
+	pkgs, err := ast.Load(fset, dir, load)
+	if loadErrs, ok := err.(ast.LoadErrors); ok {
+		// Packages failing to load are skipped, the others are still checked
+		for _, loadErr := range loadErrs {
+			logger.Warn(loadErr)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if len(pkgs.List) == 0 {
+		logger.Warnf("No packages found in %q", dir)
+		return nil, nil
+	}
+
+	changes := make(map[string][]codechange.CodeChange)
+	for _, info := range a.checkers {
+		c := info.New(fset, a.options)
+		c.SetPackages(pkgs.List)
+		c.SetReadOnly(pkgs.IsReadOnly)
+		c.SetTypes(pkgs.TypesOf)
+		c.SetContext(ctx)
+		checkerChanges := c.CodeChanges()
+		if err := ctx.Err(); err != nil {
+			// The analysis was interrupted, its changes are partial
+			return nil, err
+		}
+		for _, change := range checkerChanges {
+			changes[change.Filename] = append(changes[change.Filename], change)
+		}
+		logger.WithField(log.FieldChecker, info.Name).Debugf("%d changes", len(checkerChanges))
+	}
+
+	return changes, nil
+}
+
+// packageDir returns the directory of the package pattern arg, `dir` or `dir/...`.
+// Packages are always loaded recursively.
+func packageDir(arg string) (string, error) {
+	dir := strings.TrimSuffix(filepath.ToSlash(arg), "/...")
+	if dir == "..." {
+		dir = "."
+	}
+	if strings.Contains(dir, "...") {
+		return "", fmt.Errorf("unsupported package pattern %q, expecting a directory", arg)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%q is not a directory", arg)
+	}
+
+	return filepath.FromSlash(dir), nil
+}
+
+// localChanges runs the checkers selected by the flags on the packages of args[0], with the returned analysis.
+func localChanges(cmd *cobra.Command, args []string) (*analysis, string, map[string][]codechange.CodeChange, error) {
+	dir, err := packageDir(args[0])
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	a, err := opts.analysis(cmd, cfg, checker.ChanDirectionAll)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	changes, err := a.run(rootCtx, dir)
+	return a, dir, changes, err
+}
+
+// result is the JSON output of the changes.
+type result struct {
+	Count   int
+	Changes map[string][]codechange.CodeChange
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check DIR[/...]",
+	Short: "Report the changes the checkers would make to the packages of a directory.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a, dir, changes, err := localChanges(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		return a.printChanges(dir, changes, opts.format)
+	},
+}
+
+// printChanges prints the changes made by the checkers of a to the files in dir using format.
+func (a *analysis) printChanges(dir string, changes map[string][]codechange.CodeChange, format string) error {
+	var filenames []string
+	count := 0
+	for filename, fchanges := range changes {
+		filenames = append(filenames, filename)
+		count += len(fchanges)
+	}
+	sort.Strings(filenames)
+
+	switch format {
+	case "json":
+		return json.NewEncoder(os.Stdout).Encode(result{Count: count, Changes: changes})
+	case "sarif":
+		// The rules are the checkers which ran
+		var rules []sarif.Rule
+		for _, info := range a.checkers {
+			rules = append(rules, sarif.Rule{ID: info.Name, Description: info.Description})
+		}
+
+		sarifLog, err := sarif.NewLog(dir, rules, changes)
+		if err != nil {
+			return err
+		}
+		return sarifLog.Write(os.Stdout)
+	case "text":
+		for _, filename := range filenames {
+			for _, change := range changes[filename] {
+				message := change.Message
+				if message == "" {
+					message = change.String()
+				}
+				fmt.Printf("%s:%d:%d: %s: %s\n", change.Filename, change.Line, change.Column, change.Source, message)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expecting text, json or sarif", format)
+}
+
+var fixCmd = &cobra.Command{
+	Use:   "fix DIR[/...]",
+	Short: "Apply the changes of the checkers to the packages of a directory.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a, dir, changes, err := localChanges(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		// The SARIF output reads the files to locate the changes, it's written before they change
+		if err := a.printChanges(dir, changes, opts.format); err != nil {
+			return err
+		}
+
+		return codechange.FilesApplyChangesInplace(changes)
+	},
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff DIR[/...]",
+	Short: "Print the changes of the checkers to the packages of a directory as a patch.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, dir, changes, err := localChanges(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		patch, err := codechange.Patch(dir, changes, opts.context)
+		if err != nil {
+			return err
+		}
+
+		_, err = os.Stdout.Write(patch)
+		return err
+	},
+}
+
+var checkersCmd = &cobra.Command{
+	Use:   "checkers",
+	Short: "List the checkers.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, info := range checker.All() {
+			fmt.Printf("%s\t%s\n", info.Name, info.Description)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd, fixCmd, diffCmd, checkersCmd)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-github/github"
+	"github.com/segflow/contribuehub/pkg/checker"
+	"github.com/segflow/contribuehub/pkg/codechange"
+	"github.com/segflow/contribuehub/pkg/config"
+	"github.com/segflow/contribuehub/pkg/log"
+	"github.com/segflow/contribuehub/pkg/repository"
+	"github.com/segflow/contribuehub/pkg/verify"
+	"github.com/spf13/cobra"
+)
+
+// processor analyses cloned repositories, verifies and keeps the changes.
+type processor struct {
+	analysis *analysis
+	verifier *verify.Verifier
+
+	// patchDir contains the patch of the changes made to each repository
+	patchDir string
+}
+
+// newProcessor returns the processor configured by cfg and the flags.
+// Changes are sent upstream, by default the API of importable packages must not break.
+func newProcessor(cmd *cobra.Command, cfg *config.Config) (*processor, error) {
+	a, err := opts.analysis(cmd, cfg, checker.ChanDirectionInternal)
+	if err != nil {
+		return nil, err
+	}
+
+	// Repositories are processed concurrently, each one gets its share of the CPUs
+	a.options.Concurrency = cfg.Concurrency.AnalysisConcurrency()
+	a.load.Concurrency = a.options.Concurrency
+
+	if cfg.Verify.Sandbox {
+		if err := verify.CheckSandbox(); err != nil {
+			return nil, fmt.Errorf("%v, are user namespaces enabled? The sandbox is disabled by verify.sandbox", err)
+		}
+	}
+
+	return &processor{
+		analysis: a,
+		verifier: &verify.Verifier{
+			Tests:       cfg.Verify.Tests,
+			Timeout:     cfg.Verify.Timeout,
+			ModCache:    cfg.Verify.ModCache,
+			BuildCache:  cfg.Verify.BuildCache,
+			Sandbox:     cfg.Verify.Sandbox,
+			GoProxy:     cfg.Verify.GoProxy,
+			Parallelism: cfg.Verify.Parallelism,
+			MemoryLimit: cfg.Verify.MemoryLimit,
+		},
+		patchDir: cfg.Publisher.PatchDir,
+	}, nil
+}
+
+// process runs the analysis on repo, applies the changes, provided they pass the verification, and records their patch.
+// When ctx is done during the verification, the changes are discarded.
+func (p *processor) process(ctx context.Context, repo *repository.Repository) (*processResult, error) {
+	changes, patch, err := p.analyse(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(changes) == 0 {
+		return &processResult{Repository: repo}, nil
+	}
+
+	verification, err := p.verify(ctx, repo, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &processResult{
+		Repository:   repo,
+		fileCount:    len(changes),
+		verification: verification,
+	}
+	if verification.Outcome == verify.Passed {
+		result.patchFile, err = p.record(repo.Repository, patch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// analyse returns the changes of the analysis of repo, and their patch.
+func (p *processor) analyse(ctx context.Context, repo *repository.Repository) (map[string][]codechange.CodeChange, []byte, error) {
+	changes, err := p.analysis.run(ctx, repo.LocalDirectory)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(changes) == 0 {
+		return nil, nil, nil
+	}
+
+	// The patch is computed before applying the changes since it reads the original files
+	patch, err := codechange.Patch(repo.LocalDirectory, changes, codechange.DefaultContext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error computing patch of %q: %v", repo.LocalDirectory, err)
+	}
+
+	return changes, patch, nil
+}
+
+// verify applies the changes to repo, and keeps them provided they pass the verification.
+// When ctx is done during the verification, the changes are discarded and the error is ctx's.
+func (p *processor) verify(ctx context.Context, repo *repository.Repository, changes map[string][]codechange.CodeChange) (*verify.Verification, error) {
+	before := p.verifier.Run(ctx, repo.LocalDirectory)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	logger := log.FromContext(ctx)
+	logger.Infof("Applying changes to %d files of %q", len(changes), repo.LocalDirectory)
+
+	err := applyChanges(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	after := p.verifier.Run(ctx, repo.LocalDirectory)
+	if ctx.Err() != nil {
+		// The changes can't be verified, the clone is left unchanged
+		if err := repo.Reset(); err != nil {
+			return nil, fmt.Errorf("error discarding changes: %v", err)
+		}
+		return nil, ctx.Err()
+	}
+
+	verification := verify.Compare(before, after)
+	if verification.Outcome != verify.Passed {
+		logger.Infof("Discarding changes to %q, %s: %s", repo.LocalDirectory, verification.Outcome, verification.Reason)
+		if err := repo.Reset(); err != nil {
+			return nil, fmt.Errorf("error discarding changes: %v", err)
+		}
+	}
+
+	return verification, nil
+}
+
+// openLog returns a copy of ctx whose logger also writes to the log file of repo, next to its patch.
+// The file must be closed once the repository is processed.
+func (p *processor) openLog(ctx context.Context, repo *github.Repository) (context.Context, *log.File, error) {
+	filename := filepath.Join(p.patchDir, repo.GetOwner().GetLogin(), repo.GetName()+".log")
+	ctx, f, err := log.OpenFile(ctx, filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening log file %q: %v", filename, err)
+	}
+
+	return ctx, f, nil
+}
+
+// record writes the patch of the changes of repo in patchDir, for offline review, and returns its filename.
+func (p *processor) record(repo *github.Repository, patch []byte) (string, error) {
+	dir := filepath.Join(p.patchDir, repo.GetOwner().GetLogin())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	filename := filepath.Join(dir, repo.GetName()+".patch")
+	if err := ioutil.WriteFile(filename, patch, 0644); err != nil {
+		return "", fmt.Errorf("error writing patch %q: %v", filename, err)
+	}
+
+	return filename, nil
+}
+
+func applyChanges(changes map[string][]codechange.CodeChange) error {
+	return codechange.FilesApplyChangesInplace(changes)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/segflow/contribuehub/pkg/config"
+	"github.com/segflow/contribuehub/pkg/log"
+	"github.com/spf13/cobra"
+)
+
+// configFile is the file of the --config flag
+var configFile string
+
+// loadConfig returns the validated configuration of the --config file and the environment.
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%v", err)
+	}
+
+	if err := log.Setup(cfg.Log.Format, cfg.Log.Level); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the configuration.",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [FILE]",
+	Short: "Check the configuration file, the --config one by default, and the environment overrides.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			configFile = args[0]
+		}
+
+		if _, err := loadConfig(); err != nil {
+			return err
+		}
+
+		fmt.Println("Configuration is valid")
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
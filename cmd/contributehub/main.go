@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// rootCtx is cancelled on SIGINT and SIGTERM, commands stop once it's done
+var rootCtx = context.Background()
+
+var rootCmd = &cobra.Command{
+	Use:   "contributehub",
+	Short: "Find and fix Go code improvements, locally or in GitHub repositories.",
+	// Errors are printed by main
+	SilenceErrors: true,
+	SilenceUsage:  true,
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Once stopping, a second signal kills the process
+	context.AfterFunc(ctx, stop)
+	rootCtx = ctx
+
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "configuration file, YAML or TOML, contributehub.yaml or contributehub.toml of the current directory by default")
+	opts.addFlags(rootCmd)
+}
@@ -0,0 +1,709 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/segflow/contribuehub/pkg/config"
+	"github.com/segflow/contribuehub/pkg/dashboard"
+	"github.com/segflow/contribuehub/pkg/log"
+	"github.com/segflow/contribuehub/pkg/metrics"
+	"github.com/segflow/contribuehub/pkg/publisher"
+	"github.com/segflow/contribuehub/pkg/queue"
+	"github.com/segflow/contribuehub/pkg/repository"
+	"github.com/segflow/contribuehub/pkg/verify"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/errgroup"
+)
+
+func createGitHubClient(cfg *config.Config) *github.Client {
+	ctx := context.Background()
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: cfg.GitHub.Token},
+	)
+
+	tc := oauth2.NewClient(ctx, ts)
+	tc.Transport = &metrics.Transport{Base: tc.Transport}
+	return github.NewClient(tc)
+}
+
+func newCloner(cfg *config.Config) *repository.Cloner {
+	return &repository.Cloner{
+		Depth:    cfg.Clone.Depth,
+		CloneDir: cfg.Clone.Dir,
+	}
+}
+
+// openQueue opens the queue configured by cfg.
+func openQueue(cfg *config.Config) (*queue.Queue, error) {
+	q, err := queue.Open(cfg.Queue.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening queue: %w", err)
+	}
+	q.MaxAttempts = cfg.Queue.MaxAttempts
+	q.Backoff = cfg.Queue.Backoff
+	q.MaxBackoff = cfg.Queue.MaxBackoff
+
+	return q, nil
+}
+
+type processResult struct {
+	*repository.Repository
+	fileCount int
+
+	// verification is nil when there is no change to verify
+	verification *verify.Verification
+
+	// patchFile is the published patch, empty unless the changes passed the verification
+	patchFile string
+}
+
+// pipeline runs the stages of the run command. Stages communicate through the queue: each stage takes
+// the repositories of its input state, and advances them to its output state.
+type pipeline struct {
+	cfg       *config.Config
+	queue     *queue.Queue
+	processor *processor
+	client    *github.Client
+	github    *publisher.GitHub
+	templates *publisher.Templates
+
+	// stopCtx is done once stopping, stages don't take new repositories after that
+	stopCtx context.Context
+	// workCtx is done once the shutdown timeout is exceeded, the repositories in flight are interrupted
+	workCtx context.Context
+}
+
+// ready returns nil while the pipeline takes new repositories.
+func (p *pipeline) ready() error {
+	if p.stopCtx.Err() != nil {
+		return errors.New("stopping")
+	}
+	return nil
+}
+
+// advance moves item to state.
+func (p *pipeline) advance(item *queue.Item, state queue.State) error {
+	if err := p.queue.Advance(item, state); err != nil {
+		return err
+	}
+
+	metrics.Repositories.WithLabelValues(string(state)).Inc()
+	return nil
+}
+
+// park parks item, because of reason.
+func (p *pipeline) park(item *queue.Item, reason string) error {
+	if err := p.queue.Park(item, reason); err != nil {
+		return err
+	}
+
+	metrics.Repositories.WithLabelValues(string(queue.Failed)).Inc()
+	return nil
+}
+
+// startWorkers runs workers goroutines calling work in g.
+func startWorkers(g *errgroup.Group, workers int, work func() error) {
+	for i := 0; i < workers; i++ {
+		g.Go(work)
+	}
+}
+
+// consume takes the repositories in state and calls process on each of them, until stopping.
+// process must advance, fail, park or remove the item. Errors of the queue stop the pipeline.
+// The logger of the context given to process identifies the stage and the repository, and also writes
+// to the log file of the repository once filtered.
+func (p *pipeline) consume(stage string, state queue.State, process func(ctx context.Context, item *queue.Item) error) func() error {
+	stageCtx := log.WithField(p.workCtx, log.FieldStage, stage)
+
+	return func() error {
+		for {
+			item, err := p.queue.Next(p.stopCtx, state)
+			if p.stopCtx.Err() != nil {
+				// Stopping
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("error taking %s repository: %v", state, err)
+			}
+
+			if err := p.processItem(stageCtx, item, process); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// processItem calls process on item, with the logger of item.
+func (p *pipeline) processItem(ctx context.Context, item *queue.Item, process func(ctx context.Context, item *queue.Item) error) error {
+	fields := logrus.Fields{log.FieldRepo: item.Name()}
+	if item.SHA != "" {
+		fields[log.FieldSHA] = item.SHA
+	}
+	ctx = log.WithFields(ctx, fields)
+	if item.State == queue.Discovered {
+		// Most discovered repositories are filtered out, they don't get a log file
+		return process(ctx, item)
+	}
+
+	ctx, logFile, err := p.processor.openLog(ctx, item.Repo)
+	if err != nil {
+		// The repository is still processed, its messages only go to the standard logger
+		log.FromContext(ctx).Warn(err)
+		return process(ctx, item)
+	}
+	defer logFile.Close()
+
+	return process(ctx, item)
+}
+
+// fail records the failure of item. Items interrupted by the shutdown are released instead,
+// they resume in the same state on restart.
+func (p *pipeline) fail(ctx context.Context, item *queue.Item, err error) error {
+	logger := log.FromContext(ctx)
+	if p.workCtx.Err() != nil {
+		logger.Infof("Repository interrupted while %s", item.State)
+		p.queue.Release(item)
+		return nil
+	}
+
+	logger.Warnf("Error processing repository, %s: %s", item.State, err)
+	if err := p.queue.Fail(item, err); err != nil {
+		return err
+	}
+
+	if item.State == queue.Failed {
+		metrics.Repositories.WithLabelValues(string(queue.Failed)).Inc()
+	}
+	return nil
+}
+
+// discover adds the discovered repositories to the queue until stopping.
+func (p *pipeline) discover() error {
+	discoverer := repository.NewEventDiscoverer(p.client)
+	discoverer.Period = p.cfg.Discoverers.Events.Period
+	discoverer.PerPage = p.cfg.Discoverers.Events.PerPage
+	discoverer.Workers = p.cfg.Discoverers.Events.Workers
+
+	for repo := range discoverer.Discover(p.stopCtx) {
+		added, err := p.queue.Add(repo)
+		if err != nil {
+			return err
+		}
+		if added {
+			metrics.Repositories.WithLabelValues(string(queue.Discovered)).Inc()
+		}
+	}
+
+	return nil
+}
+
+// filter advances the discovered repositories passing the filter, and removes the others.
+func (p *pipeline) filter() func() error {
+	filter := &repository.Filter{
+		IncludeFork: p.cfg.Filter.IncludeForks,
+		Languages:   make(map[string]bool),
+		MinStars:    p.cfg.Filter.MinStars,
+		Ignore:      p.cfg.Filter.Ignore,
+	}
+	for _, language := range p.cfg.Filter.Languages {
+		filter.Languages[language] = true
+	}
+
+	return p.consume("filter", queue.Discovered, func(ctx context.Context, item *queue.Item) error {
+		if !filter.Check(item.Repo) {
+			log.FromContext(ctx).Debug("Filtered out")
+			return p.queue.Remove(item)
+		}
+		return p.advance(item, queue.Filtered)
+	})
+}
+
+// clone clones the filtered repositories.
+func (p *pipeline) clone() func() error {
+	cloner := newCloner(p.cfg)
+
+	return p.consume("clone", queue.Filtered, func(ctx context.Context, item *queue.Item) error {
+		start := time.Now()
+		repo, err := cloner.Clone(ctx, item.Repo)
+		if err != nil {
+			return p.fail(ctx, item, err)
+		}
+		metrics.CloneDuration.Observe(time.Since(start).Seconds())
+		if size, err := repo.Size(); err == nil {
+			metrics.CloneBytes.Observe(float64(size))
+		}
+
+		sha, err := repo.Head()
+		if err != nil {
+			return p.fail(ctx, item, err)
+		}
+
+		log.FromContext(ctx).WithField(log.FieldSHA, sha).Infof("Cloned in %q", repo.LocalDirectory)
+		item.LocalDirectory = repo.LocalDirectory
+		item.SHA = sha
+		return p.advance(item, queue.Cloned)
+	})
+}
+
+// analyse runs the checkers on the cloned repositories. Repositories without changes are removed,
+// or skipped when they have a pull request.
+func (p *pipeline) analyse() func() error {
+	return p.consume("analyse", queue.Cloned, func(ctx context.Context, item *queue.Item) error {
+		repo, err := repository.Open(item.LocalDirectory, item.Repo)
+		if err != nil {
+			return p.fail(ctx, item, err)
+		}
+
+		start := time.Now()
+		changes, patch, err := p.processor.analyse(ctx, repo)
+		if err != nil {
+			return p.fail(ctx, item, err)
+		}
+		metrics.AnalysisDuration.Observe(time.Since(start).Seconds())
+		for _, fchanges := range changes {
+			for _, change := range fchanges {
+				metrics.Changes.WithLabelValues(change.Source).Inc()
+			}
+		}
+		if len(changes) == 0 {
+			if item.PullRequest != nil {
+				// Analysed again to rebase its pull request
+				return p.skip(ctx, item, "the issues were fixed upstream")
+			}
+			return p.queue.Remove(item)
+		}
+
+		item.Changes = changes
+		item.FileCount = len(changes)
+		item.Patch = patch
+		return p.advance(item, queue.Analysed)
+	})
+}
+
+// verify applies and verifies the changes of the analysed repositories.
+// Repositories whose changes don't pass the verification are parked.
+func (p *pipeline) verify() func() error {
+	return p.consume("verify", queue.Analysed, func(ctx context.Context, item *queue.Item) error {
+		repo, err := repository.Open(item.LocalDirectory, item.Repo)
+		if err != nil {
+			return p.fail(ctx, item, err)
+		}
+		// The changes may have been applied before a crash
+		if err := repo.Reset(); err != nil {
+			return p.fail(ctx, item, err)
+		}
+
+		verification, err := p.processor.verify(ctx, repo, item.Changes)
+		if err != nil {
+			return p.fail(ctx, item, err)
+		}
+
+		metrics.Verifications.WithLabelValues(string(verification.Outcome)).Inc()
+		item.Outcome = string(verification.Outcome)
+		item.Reason = verification.Reason
+		item.Steps = verification.Steps()
+		if verification.Outcome != verify.Passed {
+			// The changes are kept, to verify them again if retried
+			return p.park(item, fmt.Sprintf("verification %s: %s", verification.Outcome, verification.Reason))
+		}
+
+		return p.advance(item, queue.Verified)
+	})
+}
+
+// review sets the publish mode of the checkers having made the verified changes, following publisher.policy.
+// The changes wait for an approval when a checker is in review mode, they are approved otherwise.
+func (p *pipeline) review() func() error {
+	return p.consume("review", queue.Verified, func(ctx context.Context, item *queue.Item) error {
+		item.Modes = make(map[string]string)
+		review := false
+		for _, fchanges := range item.Changes {
+			for _, change := range fchanges {
+				mode := p.cfg.Publisher.Policy.Mode(change.Source)
+				item.Modes[change.Source] = string(mode)
+				review = review || mode == publisher.Review
+			}
+		}
+
+		if review {
+			log.FromContext(ctx).Info("Waiting for approval")
+			return p.advance(item, queue.Pending)
+		}
+		return p.advance(item, queue.Approved)
+	})
+}
+
+// publish records the patch of the approved changes, and opens a pull request with the changes of the checkers
+// which aren't in dry-run mode. The changes of the checkers having an open pull request on the repository are left
+// out, and the repository is deferred for publisher.closed_backoff after a pull request of its checkers was closed
+// without being merged. The changes are skipped when they are already upstream, and made again when the changed
+// files were changed upstream. When only part of the changes are published, they are verified again on their own.
+func (p *pipeline) publish() func() error {
+	return p.consume("publish", queue.Approved, func(ctx context.Context, item *queue.Item) error {
+		logger := log.FromContext(ctx)
+		filename, err := p.processor.record(item.Repo, item.Patch)
+		if err != nil {
+			return p.fail(ctx, item, err)
+		}
+
+		changes, checkers := publishedChanges(item, nil)
+		if len(changes) == 0 {
+			logger.Infof("Recorded changes to %d files, verification %s, patch %s", item.FileCount, item.Outcome, filename)
+			return p.advance(item, queue.Recorded)
+		}
+
+		previous, err := p.github.Previous(ctx, item.Repo)
+		if err != nil {
+			return p.fail(ctx, item, err)
+		}
+		number := 0
+		if item.PullRequest != nil {
+			number = item.PullRequest.Number
+		}
+		duplicates := publisher.FindDuplicates(previous, checkers, number)
+		if closed := duplicates.Closed; closed != nil {
+			if until := closed.ClosedAt.Add(p.cfg.Publisher.ClosedBackoff); until.After(time.Now()) {
+				logger.Infof("Pull request %s closed without merge, backing off until %s", closed.URL, until.Format(time.RFC3339))
+				return p.queue.Defer(item, until, fmt.Sprintf("pull request %s closed without merge", closed.URL))
+			}
+		}
+		if len(duplicates.Open) > 0 {
+			for checker, open := range duplicates.Open {
+				logger.Infof("Changes of %s already proposed by pull request %s", checker, open.URL)
+			}
+			changes, checkers = publishedChanges(item, duplicates.Open)
+			if len(changes) == 0 {
+				return p.skip(ctx, item, "the changes are already proposed")
+			}
+		}
+
+		repo, err := repository.Open(item.LocalDirectory, item.Repo)
+		if err != nil {
+			return p.fail(ctx, item, err)
+		}
+		if partial(item, changes) {
+			// The changes passed the verification together, not necessarily without the others
+			if err := repo.Reset(); err != nil {
+				return p.fail(ctx, item, err)
+			}
+			verification, err := p.processor.verify(ctx, repo, changes)
+			if err != nil {
+				return p.fail(ctx, item, err)
+			}
+
+			metrics.Verifications.WithLabelValues(string(verification.Outcome)).Inc()
+			item.Outcome = string(verification.Outcome)
+			item.Reason = verification.Reason
+			item.Steps = verification.Steps()
+			if verification.Outcome != verify.Passed {
+				return p.park(item, fmt.Sprintf("verification of the changes of %s %s: %s", strings.Join(checkers, ", "), verification.Outcome, verification.Reason))
+			}
+		}
+		pr, err := p.newPullRequest(repo, item, changes, checkers)
+		if err != nil {
+			return p.fail(ctx, item, err)
+		}
+		upstream, err := p.github.Upstream(ctx, pr)
+		if err != nil {
+			return p.fail(ctx, item, err)
+		}
+		switch upstream {
+		case publisher.Fixed:
+			return p.skip(ctx, item, "the changes are already upstream")
+		case publisher.Changed:
+			return p.refresh(ctx, item, "the changed files were changed upstream")
+		}
+
+		pull, err := p.github.Open(ctx, pr)
+		if err != nil {
+			return p.fail(ctx, item, err)
+		}
+
+		if number == pull.GetNumber() {
+			// The feedback on the pull request is kept
+			logger.Infof("Rebased pull request %s with changes to %d files, patch %s", pull.GetHTMLURL(), len(changes), filename)
+			item.PullRequest.Checkers = checkers
+			return p.advance(item, queue.Published)
+		}
+
+		metrics.PullRequests.WithLabelValues("opened").Inc()
+		logger.Infof("Opened pull request %s with changes to %d files, patch %s", pull.GetHTMLURL(), len(changes), filename)
+		item.PullRequest = &queue.PullRequest{
+			Number:   pull.GetNumber(),
+			URL:      pull.GetHTMLURL(),
+			Branch:   pr.Branch,
+			State:    "open",
+			OpenedAt: pull.GetCreatedAt(),
+			Checkers: checkers,
+		}
+		return p.advance(item, queue.Published)
+	})
+}
+
+// skip moves item to the Skipped state because of reason, closing its open pull request.
+func (p *pipeline) skip(ctx context.Context, item *queue.Item, reason string) error {
+	if pr := item.PullRequest; pr != nil && pr.State == "open" {
+		if err := p.github.Close(ctx, item.Repo, pr.Number, "Closing this pull request, "+reason+"."); err != nil {
+			return p.fail(ctx, item, err)
+		}
+		pr.Withdrawn = true
+		p.closed(pr, "closed", time.Now())
+	}
+
+	log.FromContext(ctx).Infof("Skipped, %s", reason)
+	item.Skip = reason
+	return p.advance(item, queue.Skipped)
+}
+
+// refresh sends item back to the clone stage because of reason, its changes are made again on a new clone.
+// Its pull request, if any, is kept to be rebased.
+func (p *pipeline) refresh(ctx context.Context, item *queue.Item, reason string) error {
+	log.FromContext(ctx).Infof("Analysing again, %s", reason)
+	// The clones are only fetched when they exist
+	if err := os.RemoveAll(item.LocalDirectory); err != nil {
+		return p.fail(ctx, item, err)
+	}
+
+	item.LocalDirectory = ""
+	item.SHA = ""
+	item.Changes = nil
+	item.FileCount = 0
+	item.Patch = nil
+	item.Outcome = ""
+	item.Reason = ""
+	item.Steps = nil
+	item.Modes = nil
+	return p.advance(item, queue.Filtered)
+}
+
+// watch checks the open pull requests every publisher.check_period, until stopping. Their items are leased while
+// being checked.
+func (p *pipeline) watch() error {
+	ctx := log.WithField(p.workCtx, log.FieldStage, "watch")
+	ticker := time.NewTicker(p.cfg.Publisher.CheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		for _, item := range p.queue.Items() {
+			if item.State != queue.Published || item.PullRequest == nil || item.PullRequest.State != "open" {
+				continue
+			}
+			if p.stopCtx.Err() != nil {
+				return nil
+			}
+			published, ok := p.queue.Take(item.Repo.GetID(), queue.Published)
+			if !ok {
+				// Changed since listed
+				continue
+			}
+			if published.PullRequest == nil || published.PullRequest.State != "open" {
+				p.queue.Release(published)
+				continue
+			}
+			if err := p.processItem(ctx, published, p.checkPullRequest); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-p.stopCtx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkPullRequest updates the state and the feedback of the open pull request of item. When it conflicts
+// with upstream changes, it's rebased or closed following publisher.on_conflict. item is released once checked.
+// The feedback is saved as soon as fetched, it's kept whatever happens next.
+func (p *pipeline) checkPullRequest(ctx context.Context, item *queue.Item) error {
+	logger := log.FromContext(ctx)
+	pr := item.PullRequest
+	pull, err := p.github.Get(ctx, item.Repo, pr.Number)
+	if err == nil {
+		var feedback *publisher.Feedback
+		if feedback, err = p.github.Feedback(ctx, item.Repo, pr.Number); err == nil {
+			if n := len(feedback.Comments) - len(pr.Comments); n > 0 {
+				logger.Infof("%d new comments on pull request %s", n, pr.URL)
+			}
+			pr.Review = feedback.Review
+			pr.Comments = feedback.Comments
+		}
+	}
+	if err != nil {
+		// Checked again in the next period
+		logger.Warn(err)
+		p.queue.Release(item)
+		return nil
+	}
+	pr.CheckedAt = time.Now()
+	if err := p.queue.Save(item); err != nil {
+		return err
+	}
+
+	switch {
+	case pull.GetMerged():
+		logger.Infof("Pull request %s merged", pr.URL)
+		p.closed(pr, "merged", pull.GetMergedAt())
+	case pull.GetState() == "closed":
+		logger.Infof("Pull request %s closed without merge", pr.URL)
+		p.closed(pr, "closed", pull.GetClosedAt())
+	case pull.GetMergeableState() == "dirty":
+		// GitHub computes the mergeable state in the background, it's unknown on the first check after a push
+		if publisher.ConflictAction(p.cfg.Publisher.OnConflict) == publisher.RebaseConflicting {
+			return p.refresh(ctx, item, fmt.Sprintf("pull request %s conflicts with upstream changes", pr.URL))
+		}
+		if err := p.github.Close(ctx, item.Repo, pr.Number, "Closing this pull request, it conflicts with upstream changes."); err != nil {
+			logger.Warn(err)
+			p.queue.Release(item)
+			return nil
+		}
+		logger.Infof("Closed pull request %s conflicting with upstream changes", pr.URL)
+		pr.Withdrawn = true
+		p.closed(pr, "closed", time.Now())
+	}
+
+	return p.queue.Advance(item, queue.Published)
+}
+
+// closed records that pr was closed or merged, depending on state, at t.
+func (p *pipeline) closed(pr *queue.PullRequest, state string, t time.Time) {
+	pr.State = state
+	pr.ClosedAt = t
+	metrics.PullRequests.WithLabelValues(state).Inc()
+}
+
+// serve serves handler on addr, until the returned function is called. name is what it serves, for the logs
+// written to the logger of ctx.
+func serve(ctx context.Context, name, addr string, handler http.Handler) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening for %s: %v", name, err)
+	}
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	logger := log.FromContext(ctx)
+	go func() {
+		if err := server.Serve(ln); err != http.ErrServerClosed {
+			logger.Warnf("Error serving %s: %s", name, err)
+		}
+	}()
+	logger.Infof("Serving %s on %s", name, ln.Addr())
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Discover new Go repositories on GitHub, check and fix them.",
+	Long: `Discover new Go repositories on GitHub, check and fix them.
+
+Repositories go through a durable queue, the command resumes where it stopped when restarted.
+The queue is shown on the dashboard, where changes are approved before being published with publisher.review.
+
+On SIGINT or SIGTERM, the stages stop taking new repositories and the ones in flight are still processed,
+for at most shutdown.timeout. The repositories still in flight after that are interrupted and their changes
+discarded, they resume on restart. A second signal kills the process.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		proc, err := newProcessor(cmd, cfg)
+		if err != nil {
+			return err
+		}
+
+		q, err := openQueue(cfg)
+		if err != nil {
+			return err
+		}
+		defer q.Close()
+
+		// The stages stop taking repositories with stopCtx, on a signal or a failing stage.
+		// The repositories in flight are processed with workCtx, which outlives it by the shutdown timeout.
+		g, stopCtx := errgroup.WithContext(rootCtx)
+		workCtx, cancelWork := context.WithCancel(context.WithoutCancel(rootCtx))
+		defer cancelWork()
+		logger := log.FromContext(workCtx)
+		stopShutdown := context.AfterFunc(stopCtx, func() {
+			logger.Infof("Stopping, processing the repositories in flight for at most %s", cfg.Shutdown.Timeout)
+			time.AfterFunc(cfg.Shutdown.Timeout, cancelWork)
+		})
+		defer stopShutdown()
+
+		templates, err := cfg.Publisher.Template.Templates()
+		if err != nil {
+			return err
+		}
+
+		client := createGitHubClient(cfg)
+		p := &pipeline{
+			cfg:       cfg,
+			queue:     q,
+			processor: proc,
+			client:    client,
+			github:    &publisher.GitHub{Client: client},
+			templates: templates,
+			stopCtx:   stopCtx,
+			workCtx:   workCtx,
+		}
+
+		if cfg.Metrics.Listen != "" {
+			stopServer, err := serve(workCtx, "metrics", cfg.Metrics.Listen, metrics.Handler(p.ready))
+			if err != nil {
+				return err
+			}
+			defer stopServer()
+		}
+		if cfg.Dashboard.Listen != "" {
+			stopServer, err := serve(workCtx, "dashboard", cfg.Dashboard.Listen, dashboard.Handler(q))
+			if err != nil {
+				return err
+			}
+			defer stopServer()
+		}
+
+		g.Go(p.discover)
+		startWorkers(g, 1, p.filter())
+		startWorkers(g, cfg.Concurrency.Cloners, p.clone())
+		startWorkers(g, cfg.Concurrency.Processors, p.analyse())
+		startWorkers(g, cfg.Concurrency.Processors, p.verify())
+		startWorkers(g, 1, p.review())
+		startWorkers(g, 1, p.publish())
+		g.Go(p.watch)
+
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		if workCtx.Err() != nil {
+			logger.Warnf("Shutdown timeout of %s exceeded, repositories in flight were interrupted", cfg.Shutdown.Timeout)
+		}
+		logger.Info("Stopped")
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/segflow/contribuehub/pkg/codechange"
+	"github.com/segflow/contribuehub/pkg/publisher"
+	"github.com/segflow/contribuehub/pkg/queue"
+	"github.com/segflow/contribuehub/pkg/repository"
+)
+
+// publishedChanges returns the changes of item made by the checkers which aren't in dry-run mode nor in exclude, by file,
+// and these checkers, sorted. Checkers without mode, reviewed before the modes existed, are in dry-run mode.
+func publishedChanges(item *queue.Item, exclude map[string]*publisher.Previous) (map[string][]codechange.CodeChange, []string) {
+	changes := make(map[string][]codechange.CodeChange)
+	seen := make(map[string]bool)
+	var checkers []string
+	for filename, fchanges := range item.Changes {
+		for _, change := range fchanges {
+			if mode, ok := item.Modes[change.Source]; !ok || publisher.Mode(mode) == publisher.DryRun {
+				continue
+			}
+			if _, ok := exclude[change.Source]; ok {
+				continue
+			}
+			changes[filename] = append(changes[filename], change)
+			if !seen[change.Source] {
+				seen[change.Source] = true
+				checkers = append(checkers, change.Source)
+			}
+		}
+	}
+	sort.Strings(checkers)
+
+	return changes, checkers
+}
+
+// partial returns whether changes are only part of the changes of item.
+func partial(item *queue.Item, changes map[string][]codechange.CodeChange) bool {
+	n := 0
+	for _, fchanges := range item.Changes {
+		n += len(fchanges)
+	}
+	for _, fchanges := range changes {
+		n -= len(fchanges)
+	}
+	return n > 0
+}
+
+// newPullRequest returns the pull request of changes, made by checkers to the clone repo of item, with its title
+// and body generated by the templates of publisher.template.
+// The changes are discarded from the clone, the pull request has the files of its commit with only these changes.
+// The pull request opened before for item, when being rebased, is updated: its branch is reused.
+func (p *pipeline) newPullRequest(repo *repository.Repository, item *queue.Item, changes map[string][]codechange.CodeChange, checkers []string) (*publisher.PullRequest, error) {
+	if err := repo.Reset(); err != nil {
+		return nil, fmt.Errorf("error discarding changes: %v", err)
+	}
+	sha, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]publisher.File)
+	pathChanges := make(map[string][]codechange.CodeChange)
+	for filename, fchanges := range changes {
+		path, err := filepath.Rel(repo.LocalDirectory, filename)
+		if err != nil || strings.HasPrefix(path, "..") {
+			return nil, fmt.Errorf("changed file %q outside of the clone %q", filename, repo.LocalDirectory)
+		}
+		path = filepath.ToSlash(path)
+		info, err := os.Stat(filename)
+		if err != nil {
+			return nil, err
+		}
+		original, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		content, err := codechange.NewContent(filename, original, fchanges)
+		if err != nil {
+			return nil, err
+		}
+		files[path] = publisher.File{Content: content, Executable: info.Mode()&0111 != 0, Original: original}
+		pathChanges[path] = fchanges
+	}
+
+	data := publisher.NewData(item.Name(), pathChanges)
+	data.Outcome = item.Outcome
+	data.Steps = item.Steps
+	data.ClosedBackoff = p.cfg.Publisher.ClosedBackoff
+	title, body, err := p.templates.Execute(data)
+	if err != nil {
+		return nil, err
+	}
+
+	branch := "contributehub/" + strings.Join(checkers, "-") + "-" + sha[:7]
+	if item.PullRequest != nil {
+		branch = item.PullRequest.Branch
+	}
+
+	return &publisher.PullRequest{
+		Repo:     item.Repo,
+		Base:     sha,
+		Files:    files,
+		Branch:   branch,
+		Checkers: checkers,
+		Title:    title,
+		Body:     body,
+	}, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/segflow/contribuehub/pkg/queue"
+	"github.com/segflow/contribuehub/pkg/stats"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pullsState         string
+	pullsJSON          bool
+	pullsCommentFormat string
+)
+
+// queueItems returns the items of the queue configured.
+func queueItems() ([]queue.Item, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// The queue is opened by run while it's running
+	return queue.Load(cfg.Queue.Dir)
+}
+
+var pullsCmd = &cobra.Command{
+	Use:   "pulls",
+	Short: "Inspect the pull requests opened by the run command, and how they were received.",
+	Long: `Inspect the pull requests opened by the run command, and how they were received.
+
+The run command checks the open pull requests every publisher.check_period, recording in the queue
+whether they were merged or closed, their reviews and the comments of the maintainers.`,
+}
+
+var pullsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the pull requests, with their state and feedback.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		items, err := queueItems()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "PULL REQUEST\tCHECKERS\tSTATE\tREVIEW\tCOMMENTS\tOPENED")
+		for _, item := range items {
+			pr := item.PullRequest
+			if pr == nil || (pullsState != "" && pr.State != pullsState) {
+				continue
+			}
+
+			state := pr.State
+			if pr.Withdrawn {
+				state += " (withdrawn)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", pr.URL, strings.Join(pr.Checkers, ","), state, pr.Review,
+				len(pr.Comments), pr.OpenedAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+	},
+}
+
+var pullsStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Print the acceptance of the pull requests by checker, repository size and owner.",
+	Long: `Print the acceptance of the pull requests by checker, repository size and owner.
+
+The acceptance is the share of the pull requests merged among those merged or closed by the maintainers.
+The pull requests withdrawn, closed by the run command, don't count.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		items, err := queueItems()
+		if err != nil {
+			return err
+		}
+
+		s := stats.Compute(items)
+		if pullsJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(s)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, group := range []struct {
+			name  string
+			stats []*stats.Acceptance
+		}{
+			{"CHECKER", s.Checkers},
+			{"SIZE", s.SizeBands},
+			{"OWNER", s.Owners},
+			{"TOTAL", []*stats.Acceptance{&s.Total}},
+		} {
+			if group.name != "CHECKER" {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s\tOPENED\tOPEN\tMERGED\tCLOSED\tWITHDRAWN\tCOMMENTED\tCHANGES REQUESTED\tACCEPTANCE\n", group.name)
+			for _, a := range group.stats {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%.0f%%\n", a.Key, a.Opened, a.Open, a.Merged, a.Closed,
+					a.Withdrawn, a.Commented, a.ChangesRequested, 100*a.Rate())
+			}
+		}
+		return w.Flush()
+	},
+}
+
+var pullsCommentsCmd = &cobra.Command{
+	Use:   "comments",
+	Short: "Export the comments of the maintainers on the pull requests, for triage.",
+	Long: `Export the comments of the maintainers on the pull requests, for triage: the comments of the conversations,
+the reviews and the comments of the reviews on the changed lines, with their pull request and its checkers.
+
+With --format json, each comment is a JSON object on its own line.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pullsCommentFormat != "json" && pullsCommentFormat != "csv" {
+			return fmt.Errorf("unknown format %q, expecting json or csv", pullsCommentFormat)
+		}
+
+		items, err := queueItems()
+		if err != nil {
+			return err
+		}
+		comments := stats.Comments(items)
+
+		if pullsCommentFormat == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			for _, c := range comments {
+				if err := enc.Encode(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"repo", "pull_request", "pull_request_state", "checkers", "author", "association", "kind", "state", "path", "created_at", "url", "body"})
+		for _, c := range comments {
+			w.Write([]string{c.Repo, c.PullRequest, c.PullRequestState, strings.Join(c.Checkers, ","), c.Author, c.Association,
+				c.Kind, c.State, c.Path, c.CreatedAt.Format(time.RFC3339), c.URL, c.Body})
+		}
+		w.Flush()
+		return w.Error()
+	},
+}
+
+func init() {
+	pullsListCmd.Flags().StringVar(&pullsState, "state", "", "only list the pull requests in this state: open, closed or merged")
+	pullsStatsCmd.Flags().BoolVar(&pullsJSON, "json", false, "print the statistics as JSON")
+	pullsCommentsCmd.Flags().StringVar(&pullsCommentFormat, "format", "json", "format of the comments: json or csv")
+	pullsCmd.AddCommand(pullsListCmd, pullsStatsCmd, pullsCommentsCmd)
+	rootCmd.AddCommand(pullsCmd)
+}
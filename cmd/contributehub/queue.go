@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/segflow/contribuehub/pkg/queue"
+	"github.com/spf13/cobra"
+)
+
+var queueState string
+
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Inspect the queue of the repositories of the run command.",
+}
+
+var queueListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the queued repositories, with their state.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		items, err := queueItems()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "REPOSITORY\tSTATE\tATTEMPTS\tUPDATED\tERROR")
+		for _, item := range items {
+			if queueState != "" && string(item.State) != queueState {
+				continue
+			}
+
+			state := string(item.State)
+			if item.State == queue.Failed {
+				state += " (" + string(item.FailedState) + ")"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", item.Name(), state, item.Attempts, item.UpdatedAt.Format(time.RFC3339), item.LastError)
+		}
+		return w.Flush()
+	},
+}
+
+var queueRetryCmd = &cobra.Command{
+	Use:   "retry OWNER/NAME...",
+	Short: "Retry parked repositories, from the state they failed in.",
+	Long: `Retry parked repositories, from the state they failed in.
+
+While run is running, the queue is opened by run and the repositories are retried through its dashboard,
+at dashboard.listen by default.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		q, err := openQueue(cfg)
+		if errors.Is(err, queue.ErrLocked) {
+			return retryThroughDashboard(args)
+		}
+		if err != nil {
+			return err
+		}
+		defer q.Close()
+
+		for _, name := range args {
+			if err := q.Retry(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// retryThroughDashboard retries the repositories names through the dashboard of the running run command.
+func retryThroughDashboard(names []string) error {
+	c, err := newDashboardClient()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := c.do(http.MethodPost, "/api/repos/"+name+"/retry", nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	queueListCmd.Flags().StringVar(&queueState, "state", "", "only list the repositories in this state")
+	queueRetryCmd.Flags().StringVar(&dashboardURL, "dashboard", "", "URL of the dashboard of the running run command, http://<dashboard.listen> by default")
+	queueCmd.AddCommand(queueListCmd, queueRetryCmd)
+	rootCmd.AddCommand(queueCmd)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/segflow/contribuehub/pkg/log"
+	"github.com/spf13/cobra"
+)
+
+var repoCmd = &cobra.Command{
+	Use:   "repo OWNER/NAME",
+	Short: "Clone a GitHub repository, check and fix it.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		owner, name, ok := strings.Cut(args[0], "/")
+		if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("invalid repository %q, expecting OWNER/NAME", args[0])
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		p, err := newProcessor(cmd, cfg)
+		if err != nil {
+			return err
+		}
+
+		ctx := log.WithField(rootCtx, log.FieldRepo, args[0])
+		client := createGitHubClient(cfg)
+		ghRepo, _, err := client.Repositories.Get(ctx, owner, name)
+		if err != nil {
+			return fmt.Errorf("error getting repository %s: %v", args[0], err)
+		}
+
+		repo, err := newCloner(cfg).Clone(ctx, ghRepo)
+		if err != nil {
+			return fmt.Errorf("error cloning repository %s: %v", args[0], err)
+		}
+
+		ctx, logFile, err := p.openLog(ctx, ghRepo)
+		if err != nil {
+			return err
+		}
+		defer logFile.Close()
+		if sha, err := repo.Head(); err == nil {
+			ctx = log.WithField(ctx, log.FieldSHA, sha)
+		}
+
+		result, err := p.process(ctx, repo)
+		if err != nil {
+			return err
+		}
+
+		if result.fileCount == 0 {
+			fmt.Printf("No changes to %s\n", args[0])
+			return nil
+		}
+
+		fmt.Printf("%d files changed in %s, verification %s", result.fileCount, repo.LocalDirectory, result.verification.Outcome)
+		if result.verification.Reason != "" {
+			fmt.Printf(": %s", result.verification.Reason)
+		}
+		fmt.Println()
+		if result.patchFile != "" {
+			fmt.Printf("Patch: %s\n", result.patchFile)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(repoCmd)
+}
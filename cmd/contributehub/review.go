@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/segflow/contribuehub/pkg/queue"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dashboardURL string
+	reviewReason string
+)
+
+// dashboardClient calls the API of the dashboard of a running run command.
+type dashboardClient struct {
+	url string
+}
+
+// newDashboardClient returns the client of the dashboard of the --dashboard flag, by default the one
+// of the configuration.
+func newDashboardClient() (*dashboardClient, error) {
+	base := dashboardURL
+	if base == "" {
+		cfg, err := loadConfig()
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Dashboard.Listen == "" {
+			return nil, fmt.Errorf("dashboard disabled, set dashboard.listen or --dashboard")
+		}
+
+		addr := cfg.Dashboard.Listen
+		if strings.HasPrefix(addr, ":") {
+			addr = "localhost" + addr
+		}
+		base = "http://" + addr
+	}
+
+	return &dashboardClient{url: strings.TrimSuffix(base, "/")}, nil
+}
+
+// do sends a request to path and decodes its JSON response in v, unless nil.
+func (c *dashboardClient) do(method, path string, form url.Values, v interface{}) error {
+	req, err := http.NewRequest(method, c.url+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling the dashboard, is run started? %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s", strings.TrimSpace(string(msg)))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// modes returns the checkers of item with their publish mode, e.g. "chandir (review)".
+func modes(item *queue.Item) string {
+	var checkers []string
+	for checker, mode := range item.Modes {
+		checkers = append(checkers, fmt.Sprintf("%s (%s)", checker, mode))
+	}
+	sort.Strings(checkers)
+	return strings.Join(checkers, ", ")
+}
+
+var reviewCmd = &cobra.Command{
+	Use:   "review",
+	Short: "Review the changes waiting for approval before being published.",
+	Long: `Review the changes waiting for approval before being published, those of the checkers in review mode.
+
+The commands call the dashboard of the running run command, at dashboard.listen by default.`,
+}
+
+var reviewListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the repositories with changes waiting for approval.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newDashboardClient()
+		if err != nil {
+			return err
+		}
+
+		var items []queue.Item
+		if err := c.do(http.MethodGet, "/api/repos?state="+string(queue.Pending), nil, &items); err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "REPOSITORY\tFILES\tCHECKERS\tUPDATED")
+		for i := range items {
+			item := &items[i]
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", item.Name(), item.FileCount, modes(item), item.UpdatedAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+	},
+}
+
+var reviewShowCmd = &cobra.Command{
+	Use:   "show OWNER/NAME",
+	Short: "Print the patch of the changes of a repository.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newDashboardClient()
+		if err != nil {
+			return err
+		}
+
+		var item queue.Item
+		if err := c.do(http.MethodGet, "/api/repos/"+args[0], nil, &item); err != nil {
+			return err
+		}
+
+		fmt.Printf("Repository: %s\n", item.Name())
+		fmt.Printf("State: %s\n", item.State)
+		fmt.Printf("Checkers: %s\n", modes(&item))
+		fmt.Printf("Verification: %s\n\n", item.Outcome)
+		os.Stdout.Write(item.Patch)
+		return nil
+	},
+}
+
+var reviewApproveCmd = &cobra.Command{
+	Use:   "approve OWNER/NAME...",
+	Short: "Approve the changes of repositories, they are published.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newDashboardClient()
+		if err != nil {
+			return err
+		}
+
+		for _, name := range args {
+			if err := c.do(http.MethodPost, "/api/repos/"+name+"/approve", nil, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var reviewRejectCmd = &cobra.Command{
+	Use:   "reject OWNER/NAME...",
+	Short: "Reject the changes of repositories, they aren't published.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newDashboardClient()
+		if err != nil {
+			return err
+		}
+
+		form := url.Values{"reason": {reviewReason}}
+		for _, name := range args {
+			if err := c.do(http.MethodPost, "/api/repos/"+name+"/reject", form, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	reviewCmd.PersistentFlags().StringVar(&dashboardURL, "dashboard", "", "URL of the dashboard, http://<dashboard.listen> by default")
+	reviewRejectCmd.Flags().StringVar(&reviewReason, "reason", "", "why the changes are rejected")
+	reviewCmd.AddCommand(reviewListCmd, reviewShowCmd, reviewApproveCmd, reviewRejectCmd)
+	rootCmd.AddCommand(reviewCmd)
+}
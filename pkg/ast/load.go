@@ -0,0 +1,348 @@
+package ast
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// LoadConfig selects the files of the packages loaded by Load.
+type LoadConfig struct {
+	// Context interrupts the loading once done, none when nil
+	Context context.Context
+
+	// GOOS and GOARCH select the files by build constraints, the current ones when empty
+	GOOS, GOARCH string
+
+	// Tags are additional build tags
+	Tags []string
+
+	// Cgo enables cgo files, as CGO_ENABLED=1
+	Cgo bool
+
+	// Tests includes test files, and external test packages
+	Tests bool
+
+	// Exclude are patterns of files which must not be changed, see Packages.ReadOnly
+	Exclude []string
+
+	// Concurrency is the number of files parsed concurrently, GOMAXPROCS when 0
+	Concurrency int
+}
+
+// Types is the type information of a package loaded by Load.
+type Types struct {
+	Pkg  *types.Package
+	Info *types.Info
+
+	// Err is the first error reported when loading the package or one of its dependencies, the type information
+	// is then partial
+	Err error
+}
+
+// LoadError is an error reported when loading a package.
+type LoadError struct {
+	// Package is the import path of the package, empty when the error is not specific to a package
+	Package string
+
+	// Pos is the position of the error, "file:line:col", empty when unknown
+	Pos string
+
+	// Kind is the kind of error, like "list" or "parse"
+	Kind string
+
+	Msg string
+}
+
+func (e *LoadError) Error() string {
+	var b strings.Builder
+	if e.Pos != "" {
+		b.WriteString(e.Pos + ": ")
+	}
+	if e.Package != "" {
+		fmt.Fprintf(&b, "package %s: ", e.Package)
+	}
+	fmt.Fprintf(&b, "%s error: %s", e.Kind, e.Msg)
+	return b.String()
+}
+
+// LoadErrors is the list of errors reported by Load.
+type LoadErrors []*LoadError
+
+func (e LoadErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e[0], len(e)-1)
+}
+
+// Load loads the packages of every module in dir using fset. Nested modules are loaded separately,
+// with their own go.mod. Only files matching the build constraints of cfg are parsed.
+// The packages are type checked with their dependencies, see Packages.TypesOf.
+//
+// Generated, vendored and third-party files, and files matching cfg.Exclude, are loaded read only.
+//
+// Packages which failed to load partially are still returned, the error is then a LoadErrors.
+// Once cfg.Context is done, the loading stops and the error is the context's.
+func Load(fset *token.FileSet, dir string, cfg LoadConfig) (*Packages, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	roots, err := moduleRoots(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := cfg.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	pkgs := &Packages{ReadOnly: make(map[string]string), Types: make(map[*ast.Package]*Types)}
+	var errs LoadErrors
+	for _, root := range roots {
+		rootPkgs, rootTypes, rootErrs := loadModule(ctx, fset, root, cfg)
+		if err := ctx.Err(); err != nil {
+			// The errors are those of the interruption
+			return nil, err
+		}
+		pkgs.List = append(pkgs.List, rootPkgs...)
+		for pkg, t := range rootTypes {
+			pkgs.Types[pkg] = t
+		}
+		errs = append(errs, rootErrs...)
+	}
+
+	for _, pkg := range pkgs.List {
+		for filename, file := range pkg.Files {
+			rel, err := filepath.Rel(dir, filename)
+			if err != nil {
+				return nil, err
+			}
+			if reason := readOnlyReason(filepath.ToSlash(rel), file, cfg.Exclude); reason != "" {
+				pkgs.ReadOnly[filename] = reason
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		return pkgs, errs
+	}
+	return pkgs, nil
+}
+
+// moduleRoots returns dir and the directories of the modules nested in dir.
+func moduleRoots(dir string) ([]string, error) {
+	roots := []string{dir}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if path != dir && skipDir(info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.Name() == "go.mod" && filepath.Dir(path) != dir {
+			roots = append(roots, filepath.Dir(path))
+		}
+		return nil
+	})
+
+	return roots, err
+}
+
+// skipDir reports whether the go tool ignores the directory name in `./...` patterns.
+func skipDir(name string) bool {
+	return name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// loadModule loads the packages of the module in dir, or of dir if it is not in a module, with their syntax
+// and type information. Dependencies are type checked from source too, so the types of the packages are complete.
+func loadModule(ctx context.Context, fset *token.FileSet, dir string, cfg LoadConfig) ([]*ast.Package, map[*ast.Package]*Types, LoadErrors) {
+	env := os.Environ()
+	if cfg.GOOS != "" {
+		env = append(env, "GOOS="+cfg.GOOS)
+	}
+	if cfg.GOARCH != "" {
+		env = append(env, "GOARCH="+cfg.GOARCH)
+	}
+	if cfg.Cgo {
+		env = append(env, "CGO_ENABLED=1")
+	} else {
+		env = append(env, "CGO_ENABLED=0")
+	}
+	if !inModule(dir) {
+		env = append(env, "GO111MODULE=off")
+	}
+
+	var flags []string
+	if len(cfg.Tags) != 0 {
+		flags = append(flags, "-tags="+strings.Join(cfg.Tags, ","))
+	}
+
+	concurrency := cfg.Concurrency
+	if concurrency < 1 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	conf := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports |
+			packages.NeedDeps | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo,
+		Context:    ctx,
+		Dir:        dir,
+		Env:        env,
+		BuildFlags: flags,
+		Tests:      cfg.Tests,
+		Fset:       fset,
+		ParseFile: func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// Checkers rely on the resolution of the identifiers, as done by go/packages by default
+			return parser.ParseFile(fset, filename, src, parser.AllErrors|parser.ParseComments)
+		},
+	}
+
+	loaded, err := packages.Load(conf, "./...")
+	if err != nil {
+		return nil, nil, LoadErrors{{Kind: "list", Msg: fmt.Sprintf("loading %q: %v", dir, err)}}
+	}
+
+	var pkgs []*ast.Package
+	typesInfo := make(map[*ast.Package]*Types)
+	var errs LoadErrors
+	for _, p := range testVariants(loaded) {
+		for _, e := range p.Errors {
+			errs = append(errs, &LoadError{
+				Package: p.PkgPath,
+				Pos:     e.Pos,
+				Kind:    errorKind(e.Kind),
+				Msg:     e.Msg,
+			})
+		}
+
+		if len(p.GoFiles) == 0 {
+			continue
+		}
+
+		pkg, pkgErr := syntaxPackage(fset, p)
+		if pkgErr == nil {
+			pkgErr = firstError(p)
+		}
+		pkgs = append(pkgs, pkg)
+		typesInfo[pkg] = &Types{Pkg: p.Types, Info: p.TypesInfo, Err: pkgErr}
+	}
+
+	return pkgs, typesInfo, errs
+}
+
+// syntaxPackage returns the package of the syntax trees of p, indexed by filename.
+// Files preprocessed by cgo are left out, the error then reports the package as partial.
+func syntaxPackage(fset *token.FileSet, p *packages.Package) (*ast.Package, error) {
+	goFiles := make(map[string]bool)
+	for _, filename := range p.GoFiles {
+		goFiles[filename] = true
+	}
+
+	var err error
+	pkg := &ast.Package{
+		Name:  p.Name,
+		Files: make(map[string]*ast.File),
+	}
+	for _, file := range p.Syntax {
+		// The position of the package clause is not adjusted, cgo files have line directives
+		filename := fset.PositionFor(file.Package, false).Filename
+		if !goFiles[filename] {
+			err = fmt.Errorf("package %s: file %s is preprocessed by cgo", p.PkgPath, filename)
+			continue
+		}
+		pkg.Files[filename] = file
+	}
+
+	return pkg, err
+}
+
+// firstError returns the first error of p or of its dependencies, nil if they were loaded without error.
+func firstError(p *packages.Package) error {
+	var err error
+	packages.Visit([]*packages.Package{p}, func(dep *packages.Package) bool {
+		if err == nil && len(dep.Errors) != 0 {
+			err = dep.Errors[0]
+		}
+		return err == nil
+	}, nil)
+
+	return err
+}
+
+// testVariants returns the packages to analyse: when tests are loaded, a package is replaced by
+// its variant including the test files, and generated test main packages are dropped.
+func testVariants(loaded []*packages.Package) []*packages.Package {
+	byPath := make(map[string]*packages.Package)
+	var paths []string
+	for _, p := range loaded {
+		if strings.HasSuffix(p.ID, ".test") {
+			continue
+		}
+
+		if other, ok := byPath[p.PkgPath]; ok {
+			if len(p.GoFiles) > len(other.GoFiles) {
+				byPath[p.PkgPath] = p
+			}
+			continue
+		}
+		byPath[p.PkgPath] = p
+		paths = append(paths, p.PkgPath)
+	}
+	sort.Strings(paths)
+
+	var pkgs []*packages.Package
+	for _, path := range paths {
+		pkgs = append(pkgs, byPath[path])
+	}
+	return pkgs
+}
+
+// inModule reports whether dir is in a module, i.e. dir or one of its parents has a go.mod file.
+func inModule(dir string) bool {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
+
+func errorKind(kind packages.ErrorKind) string {
+	switch kind {
+	case packages.ListError:
+		return "list"
+	case packages.ParseError:
+		return "parse"
+	case packages.TypeError:
+		return "type"
+	}
+	return "unknown"
+}
@@ -0,0 +1,222 @@
+package ast
+
+import (
+	"context"
+	goast "go/ast"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "load")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for filename, content := range files {
+		path := filepath.Join(dir, filename)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"go.mod":              "module example.com/m\n\ngo 1.13\n",
+		"a/a.go":              "package a\n",
+		"a/a_linux.go":        "package a\n",
+		"a/a_windows.go":      "package a\n",
+		"a/tagged.go":         "//go:build special\n\npackage a\n",
+		"a/a_test.go":         "package a\n",
+		"a/x_test.go":         "package a_test\n",
+		"a/testdata/t.go":     "package t\n",
+		"nested/go.mod":       "module example.com/nested\n\ngo 1.13\n",
+		"nested/n.go":         "package nested\n",
+		"vendor/v/v.go":       "package v\n",
+		"_examples/e/main.go": "package main\n",
+	})
+	defer os.RemoveAll(dir)
+
+	tt := map[string]struct {
+		Config   LoadConfig
+		Expected []string
+	}{
+		"linux": {
+			Config:   LoadConfig{GOOS: "linux"},
+			Expected: []string{"a/a.go", "a/a_linux.go", "nested/n.go"},
+		},
+		"windows-tags": {
+			Config:   LoadConfig{GOOS: "windows", Tags: []string{"special"}},
+			Expected: []string{"a/a.go", "a/a_windows.go", "a/tagged.go", "nested/n.go"},
+		},
+		"tests": {
+			Config:   LoadConfig{GOOS: "linux", Tests: true},
+			Expected: []string{"a/a.go", "a/a_linux.go", "a/a_test.go", "a/x_test.go", "nested/n.go"},
+		},
+	}
+
+	for name, tc := range tt {
+		pkgs, err := Load(token.NewFileSet(), dir, tc.Config)
+		assert.NoError(t, err, name)
+
+		var filenames []string
+		for _, pkg := range pkgs.List {
+			for filename := range pkg.Files {
+				rel, _ := filepath.Rel(dir, filename)
+				filenames = append(filenames, filepath.ToSlash(rel))
+			}
+		}
+		sort.Strings(filenames)
+		assert.Equal(t, tc.Expected, filenames, name)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"go.mod":   "module example.com/m\n\ngo 1.13\n",
+		"a/a.go":   "package a\n\nfunc A() {\n",
+		"b/b.go":   "package b\n",
+		"c/c1.go":  "package c\n",
+		"c/c2.go":  "package d\n",
+		"d/doc.go": "package d\n",
+	})
+	defer os.RemoveAll(dir)
+
+	pkgs, err := Load(token.NewFileSet(), dir, LoadConfig{})
+	loadErrs, ok := err.(LoadErrors)
+	if !assert.True(t, ok, "%v", err) {
+		return
+	}
+
+	packages := make(map[string]bool)
+	for _, loadErr := range loadErrs {
+		packages[loadErr.Package] = true
+	}
+	assert.True(t, packages["example.com/m/a"], loadErrs.Error())
+	assert.True(t, packages["example.com/m/c"], loadErrs.Error())
+
+	// Packages loading fine are still returned
+	var names []string
+	for _, pkg := range pkgs.List {
+		names = append(names, pkg.Name)
+	}
+	assert.Contains(t, names, "b")
+	assert.Contains(t, names, "d")
+}
+
+func TestLoadContext(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.13\n",
+		"a/a.go": "package a\n",
+	})
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	pkgs, err := Load(token.NewFileSet(), dir, LoadConfig{Context: ctx})
+	assert.Nil(t, pkgs)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestLoadReadOnly(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"go.mod":                 "module example.com/m\n\ngo 1.13\n",
+		"a/a.go":                 "package a\n",
+		"a/a.pb.go":              "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage a\n",
+		"a/zz_generated.deep.go": "// +build !ignore\n\n// Code generated by deepcopy-gen. DO NOT EDIT.\n\npackage a\n",
+		"a/mock.go":              "package a\n",
+		"third_party/t/t.go":     "package t\n",
+		"gen/api/api.go":         "package api\n",
+	})
+	defer os.RemoveAll(dir)
+
+	pkgs, err := Load(token.NewFileSet(), dir, LoadConfig{Exclude: []string{"mock.go", "gen/*"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	readOnly := make(map[string]string)
+	for filename, reason := range pkgs.ReadOnly {
+		rel, _ := filepath.Rel(dir, filename)
+		readOnly[filepath.ToSlash(rel)] = reason
+	}
+
+	assert.Equal(t, map[string]string{
+		"a/a.pb.go":              "generated",
+		"a/zz_generated.deep.go": "generated",
+		"a/mock.go":              "excluded by mock.go",
+		"third_party/t/t.go":     "third_party directory",
+		"gen/api/api.go":         "excluded by gen/*",
+	}, readOnly)
+	assert.False(t, pkgs.IsReadOnly(filepath.Join(dir, "a/a.go")))
+}
+
+func TestMatchExclude(t *testing.T) {
+	tt := []struct {
+		Pattern  string
+		Path     string
+		Expected bool
+	}{
+		{"*.pb.go", "api/a.pb.go", true},
+		{"*.pb.go", "api/a.go", false},
+		{"api/*.go", "api/a.go", true},
+		{"api/*.go", "pkg/api/a.go", false},
+		{"pkg/gen", "pkg/gen/sub/a.go", true},
+		{"pkg/gen", "pkg/generator/a.go", false},
+	}
+
+	for _, tc := range tt {
+		assert.Equal(t, tc.Expected, matchExclude(tc.Pattern, tc.Path), "%s %s", tc.Pattern, tc.Path)
+	}
+}
+
+func TestLoadTypes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.13\n",
+		"a/a.go": "package a\n\ntype Sink interface{ Put(chan int) }\n",
+		"b/b.go": "package b\n\nimport \"example.com/m/a\"\n\ntype T struct{}\n\nfunc (T) Put(ch chan int) {}\n\nvar _ a.Sink = T{}\n",
+		"c/c.go": "package c\n\nvar x int = \"x\"\n",
+	})
+	defer os.RemoveAll(dir)
+
+	pkgs, err := Load(token.NewFileSet(), dir, LoadConfig{})
+	assert.Error(t, err)
+
+	byName := make(map[string]*goast.Package)
+	for _, pkg := range pkgs.List {
+		byName[pkg.Name] = pkg
+	}
+
+	tpkg, info, err := pkgs.TypesOf(byName["b"])
+	if !assert.NoError(t, err) || !assert.NotNil(t, tpkg) {
+		return
+	}
+	assert.NotEmpty(t, info.Uses)
+	// Packages of the module are imported with their types
+	sink := tpkg.Imports()[0].Scope().Lookup("Sink")
+	if assert.NotNil(t, sink) {
+		assert.True(t, types.Implements(tpkg.Scope().Lookup("T").Type(), sink.Type().Underlying().(*types.Interface)))
+	}
+
+	_, _, err = pkgs.TypesOf(byName["c"])
+	assert.Error(t, err)
+
+	tpkg, info, err = pkgs.TypesOf(&goast.Package{})
+	assert.Nil(t, tpkg)
+	assert.Nil(t, info)
+	assert.NoError(t, err)
+}
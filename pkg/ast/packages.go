@@ -5,14 +5,10 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
-	"log"
-	"os"
-	"path/filepath"
 )
 
-func PackagesFromCode(codes ...string) []*ast.Package {
-	fset := token.NewFileSet()
-
+// PackagesFromCode parses each code as a single file package using fset.
+func PackagesFromCode(fset *token.FileSet, codes ...string) []*ast.Package {
 	var pkgs []*ast.Package
 	for i, code := range codes {
 		fname := fmt.Sprintf("filename-%d", i)
@@ -26,37 +22,3 @@ func PackagesFromCode(codes ...string) []*ast.Package {
 
 	return pkgs
 }
-
-func ParseDirPackages(fset *token.FileSet, dir string) []*ast.Package {
-	var allPkgs []*ast.Package
-	var walk = func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			fmt.Printf("error %v at a path %q\n", err, path)
-			return err
-		}
-
-		if !info.IsDir() {
-			return nil
-		}
-
-		lastDir := filepath.Base(path)
-		if lastDir == "testdata" || lastDir == "vendor" {
-			return filepath.SkipDir
-		}
-
-		pkgs, err := parser.ParseDir(fset, path, nil, parser.ParseComments)
-		if err != nil {
-			log.Printf("error parsing dir %q: %s\n", dir, err)
-			return nil
-		}
-
-		for _, pkg := range pkgs {
-			allPkgs = append(allPkgs, pkg)
-		}
-
-		return nil
-	}
-
-	filepath.Walk(dir, walk)
-	return allPkgs
-}
@@ -0,0 +1,87 @@
+package ast
+
+import (
+	"go/ast"
+	"go/types"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// readOnlyDirs are the directories holding code which is not maintained in the repository.
+var readOnlyDirs = map[string]bool{
+	"vendor":      true,
+	"third_party": true,
+	"_examples":   true,
+}
+
+// Packages are the packages returned by Load.
+type Packages struct {
+	List []*ast.Package
+
+	// ReadOnly holds the files which checkers may read but must not change, with the reason why.
+	ReadOnly map[string]string
+
+	// Types holds the type information of the packages of List.
+	Types map[*ast.Package]*Types
+}
+
+// IsReadOnly reports whether the file filename must not be changed.
+func (p *Packages) IsReadOnly(filename string) bool {
+	_, ok := p.ReadOnly[filename]
+	return ok
+}
+
+// TypesOf returns the type information of pkg, and the error making it partial if any.
+// It returns nil type information for the packages not loaded by Load.
+func (p *Packages) TypesOf(pkg *ast.Package) (*types.Package, *types.Info, error) {
+	t, ok := p.Types[pkg]
+	if !ok {
+		return nil, nil, nil
+	}
+	return t.Pkg, t.Info, t.Err
+}
+
+// readOnlyReason returns why the file must not be changed, or an empty string if it can be.
+// rel is the path of the file relative to the loaded directory, using slashes.
+//
+// Generated files, files of vendor, third_party and _examples directories, and files matching
+// one of the exclude patterns are read only.
+func readOnlyReason(rel string, file *ast.File, exclude []string) string {
+	if file != nil && ast.IsGenerated(file) {
+		return "generated"
+	}
+
+	elems := strings.Split(path.Dir(rel), "/")
+	for _, elem := range elems {
+		if readOnlyDirs[elem] {
+			return elem + " directory"
+		}
+	}
+
+	for _, pattern := range exclude {
+		if matchExclude(pattern, rel) {
+			return "excluded by " + pattern
+		}
+	}
+
+	return ""
+}
+
+// matchExclude reports whether the file rel matches the exclude pattern, a filepath.Match pattern.
+// A pattern without slash is matched against the file name, e.g. `*.pb.go`. Other patterns are
+// matched against the path of the file and its directories, e.g. `pkg/gen` matches the files of pkg/gen.
+func matchExclude(pattern string, rel string) bool {
+	pattern = filepath.ToSlash(pattern)
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+
+	for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
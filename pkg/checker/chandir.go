@@ -1,287 +1,1093 @@
 package checker
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"go/ast"
+	"go/importer"
+	"go/printer"
 	"go/token"
+	"go/types"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/segflow/contribuehub/pkg/codechange"
 )
 
 const (
 	biDirectionalChan = ast.SEND | ast.RECV // 3
-)
-
-var (
-	exampleFunc = `
-	package test
 
-	func A(a chan int) {
-		f := func() {
-			b := <-a
-		}
-	}
-`
+	// chanDirectionSource is the source of the changes made by ChanDirectionChecker
+	chanDirectionSource = "chandir"
 )
 
+// ChanDirectionChecker narrows bidirectional channels to send only or receive only channels.
+// Functions parameters and results, and unexported struct fields are narrowed based on their usage in the whole package.
 type ChanDirectionChecker struct {
-	// funcsWithBidirChan holds the list of functions with bidirectional channels in params
-	// Keys can be either *ast.FuncDecl or *ast.FuncLit, value is a map of parameterName -> *ast.Field
-	funcsWithBidirChan map[ast.Node][]*ast.Field
+	// candidates holds the fields declaring bidirectional channels that may be narrowed:
+	// functions parameters and results, and struct fields.
+	candidates []*ast.Field
 
-	// localFuncCalls holds the list of callExpr
-	localFuncCalls map[ast.Node][]*ast.CallExpr
+	// vars holds the channel parameters and local variables being tracked, indexed by their object.
+	vars map[*ast.Object]chanVar
 
-	pkgs []*ast.Package
-	fset *token.FileSet
-}
+	// fieldVars holds the struct fields being tracked, indexed by their type object.
+	fieldVars map[types.Object]chanVar
+
+	// structFields holds the struct fields declaring several names, e.g: `a, b chan int`.
+	// Unlike parameters, they cannot be split, so their names must share the same direction.
+	structFields []*ast.Field
+
+	// results holds the results of the functions being tracked, one entry per result.
+	// Results not being tracked are set to the zero chanVar.
+	results map[*ast.FuncDecl][]chanVar
+
+	// usage holds how each channel variable is used, including the usage inherited from callees.
+	usage map[chanVar]ast.ChanDir
+
+	// flows holds channel variables passed as is to a function or assigned to a new local variable.
+	flows []chanFlow
+
+	// pinned holds the variables that will keep their bidirectional type.
+	// Pinned variables are seen as bidirectional by their users.
+	pinned map[chanVar]bool
 
-type chanDirChange struct {
-	ParameterName string
-	NewDirection  ast.ChanDir
-	Position      token.Position
-	Offset        int
+	// info holds the type information of the package being analyzed
+	info *types.Info
+	tpkg *types.Package
+
+	// files holds the files of the package being analyzed
+	files []*ast.File
+
+	// funcDecls holds the functions and methods declared in the package being analyzed, indexed by their object.
+	funcDecls map[types.Object]*ast.FuncDecl
+
+	// mode defines which functions are allowed to change
+	mode ChanDirectionMode
+
+	// readOnly reports the files which must not change
+	readOnly func(filename string) bool
+
+	// types returns the type information of the packages, when loaded with it
+	types func(pkg *ast.Package) (*types.Package, *types.Info, error)
+
+	// concurrency is the number of packages type checked concurrently
+	concurrency int
+
+	// ctx interrupts the analysis once done
+	ctx context.Context
+
+	importer types.Importer
+	pkgs     []*ast.Package
+	fset     *token.FileSet
 }
 
-func (c chanDirChange) toCodeChange() codechange.CodeChange {
-	delta := len(c.ParameterName) + 1
-	if c.NewDirection == ast.SEND {
-		delta += len("chan")
-	}
+// chanVar is a channel variable: a function parameter or result, a struct field or a local variable.
+// Variables sharing a field like `a, b chan int` are distinct.
+type chanVar struct {
+	// field is nil for local variables, whose type is inferred
+	field *ast.Field
+	// name is nil for unnamed parameters and results
+	name *ast.Ident
+}
 
-	return codechange.CodeChange{
-		Filename: c.Position.Filename,
-		Line:     c.Position.Line,
-		Column:   c.Position.Column + delta,
-		Offset:   c.Position.Offset + delta,
-		Add:      []byte("<-"),
-	}
+// chanFlow records a channel variable `from` being used as the variable `to`.
+// e.g: passed as argument for the parameter `to` of another function, or assigned to the new local variable `to`.
+type chanFlow struct {
+	from chanVar
+	to   chanVar
 }
 
 func NewChanDirectionChecker(fset *token.FileSet) *ChanDirectionChecker {
 	return &ChanDirectionChecker{
-		funcsWithBidirChan: make(map[ast.Node][]*ast.Field),
-		localFuncCalls:     make(map[ast.Node][]*ast.CallExpr),
-		fset:               fset,
+		vars:        make(map[*ast.Object]chanVar),
+		fieldVars:   make(map[types.Object]chanVar),
+		results:     make(map[*ast.FuncDecl][]chanVar),
+		usage:       make(map[chanVar]ast.ChanDir),
+		pinned:      make(map[chanVar]bool),
+		importer:    &syncImporter{imp: importer.Default()},
+		concurrency: runtime.GOMAXPROCS(0),
+		ctx:         context.Background(),
+		fset:        fset,
+	}
+}
+
+// SetConcurrency sets the number of packages type checked concurrently. Defaults to GOMAXPROCS.
+func (c *ChanDirectionChecker) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
 	}
+	c.concurrency = n
 }
 
+// SetMode sets which functions the checker is allowed to change. Defaults to ChanDirectionAll.
+func (c *ChanDirectionChecker) SetMode(mode ChanDirectionMode) {
+	c.mode = mode
+}
+
+// SetContext sets the context interrupting the analysis once done. CodeChanges then returns no change.
+func (c *ChanDirectionChecker) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// CodeChanges returns the changes narrowing channels, sorted by file and offset.
+// It returns nil once the context of the checker is done, the analysis being interrupted between packages.
 func (c *ChanDirectionChecker) CodeChanges() []codechange.CodeChange {
-	// Step 1: Get all functions/methods with at least one bidirectional channels parameter
-	for _, pkg := range c.pkgs {
-		funcs := c.biDirChanFuncs(pkg)
-		if len(funcs) == 0 {
-			continue
+	// Type checking is the costly part, packages are type checked concurrently
+	typed := c.typeCheckPackages()
+
+	// candidatesPkg holds the package declaring each candidate
+	candidatesPkg := make(map[*ast.Field]*typedPackage)
+	for _, tp := range typed {
+		if c.ctx.Err() != nil {
+			return nil
 		}
-		for node, fields := range funcs {
-			c.funcsWithBidirChan[node] = fields
+		c.use(tp)
+
+		// Step 1: Get all parameters, results and struct fields declared as bidirectional channels
+		n := len(c.candidates)
+		c.collectCandidates(tp.pkg, c.protectedFuncs(tp.pkg, c.tpkg), tp.err != nil)
+		for _, field := range c.candidates[n:] {
+			candidatesPkg[field] = tp
 		}
+
+		// Step 2: Compute how each of them is used in the package
+		c.collectUsages(tp.pkg)
+	}
+
+	// Step 3: Propagate the usage of channels passed to other functions or variables.
+	if !c.propagateUsage() {
+		return nil
 	}
 
 	var reports []codechange.CodeChange
-	for fn, params := range c.funcsWithBidirChan {
-		chansUsage := c.funcsChanParamsUsage(fn, params)
-		for field, usage := range chansUsage {
-			if usage == biDirectionalChan {
-				continue
-			}
+	for _, field := range c.candidates {
+		c.use(candidatesPkg[field])
+		reports = append(reports, c.fieldChanges(field)...)
+	}
+
+	sort.SliceStable(reports, func(i, j int) bool {
+		if reports[i].Filename != reports[j].Filename {
+			return reports[i].Filename < reports[j].Filename
+		}
+		return reports[i].Offset < reports[j].Offset
+	})
+
+	return reports
+}
+
+// typedPackage is a package with its type information.
+type typedPackage struct {
+	pkg   *ast.Package
+	files []*ast.File
+	tpkg  *types.Package
+	info  *types.Info
+	// err is the first type error of the package, its type information is then partial
+	err       error
+	funcDecls map[types.Object]*ast.FuncDecl
+}
+
+// use makes tp the package being analyzed.
+func (c *ChanDirectionChecker) use(tp *typedPackage) {
+	c.files, c.tpkg, c.info, c.funcDecls = tp.files, tp.tpkg, tp.info, tp.funcDecls
+}
 
-			// Channel is a send only channel
-			if usage == ast.SEND {
-				pos := field.Pos()
-				reports = append(reports, chanDirChange{
-					NewDirection:  ast.SEND,
-					ParameterName: field.Names[0].Name,
-					Position:      c.fset.Position(pos),
-					Offset:        c.fset.Position(pos).Offset,
-				}.toCodeChange())
+// typeCheckPackages type checks the packages without type information using up to c.concurrency goroutines.
+// Packages are returned in the same order as c.pkgs.
+func (c *ChanDirectionChecker) typeCheckPackages() []*typedPackage {
+	typed := make([]*typedPackage, len(c.pkgs))
+	sem := make(chan struct{}, c.concurrency)
+	var wg sync.WaitGroup
+	for i, pkg := range c.pkgs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, pkg *ast.Package) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if c.ctx.Err() != nil {
+				// The packages are left out, CodeChanges returns no change
+				return
 			}
 
-			// Channel is a recv only channel
-			if usage == ast.RECV {
-				pos := field.Pos()
-				reports = append(reports, chanDirChange{
-					NewDirection:  ast.RECV,
-					ParameterName: field.Names[0].Name,
-					Position:      c.fset.Position(pos),
-					Offset:        c.fset.Position(pos).Offset,
-				}.toCodeChange())
+			files := pkgFiles(pkg)
+			var tpkg *types.Package
+			var info *types.Info
+			var err error
+			if c.types != nil {
+				tpkg, info, err = c.types(pkg)
 			}
-		}
+			if info == nil {
+				tpkg, info, err = typeCheck(c.fset, c.importer, files, pkg.Name)
+			}
+			typed[i] = &typedPackage{
+				pkg:       pkg,
+				files:     files,
+				tpkg:      tpkg,
+				info:      info,
+				err:       err,
+				funcDecls: funcDecls(pkg, info),
+			}
+		}(i, pkg)
 	}
+	wg.Wait()
 
-	return reports
+	return typed
 }
 
 func (c *ChanDirectionChecker) SetPackages(pkgs []*ast.Package) {
 	c.pkgs = pkgs
 }
 
-// biDirChanParams returns the names of bi directional channel found in func param.
-func (c *ChanDirectionChecker) biDirChanParams(fn *ast.FuncDecl) []*ast.Field {
-	params := fn.Type.Params.List
-	var biDirChans []*ast.Field
-	for _, param := range params {
-		t, ok := param.Type.(*ast.ChanType) // If not a chan type we ignore it
-		if !ok {
-			continue
+// SetReadOnly sets the function reporting the files which must not change.
+// Declarations of read only files are analysed but never narrowed.
+func (c *ChanDirectionChecker) SetReadOnly(readOnly func(filename string) bool) {
+	c.readOnly = readOnly
+}
+
+// SetTypes sets the function returning the type information of the packages, loaded with their dependencies.
+// Packages without type information are type checked by the checker, importing their dependencies from export data.
+func (c *ChanDirectionChecker) SetTypes(typesOf func(pkg *ast.Package) (*types.Package, *types.Info, error)) {
+	c.types = typesOf
+}
+
+// collectCandidates registers the bidirectional channels of pkg that may be narrowed.
+// Parameters and results of protected functions, and declarations of read only files, are tracked but pinned.
+// Every declaration of a package with type errors is pinned: with partial type information, the interfaces
+// implemented by its types and the functions used as values may be missed.
+func (c *ChanDirectionChecker) collectCandidates(pkg *ast.Package, protected map[*ast.FuncDecl]bool, typeErrors bool) {
+	for _, file := range c.files {
+		readOnly := typeErrors || (c.readOnly != nil && c.readOnly(c.fset.Position(file.Package).Filename))
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				c.collectFuncCandidates(decl, readOnly || protected[decl])
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok {
+						c.collectStructCandidates(ts, readOnly)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (c *ChanDirectionChecker) collectFuncCandidates(fn *ast.FuncDecl, protected bool) {
+	track := func(v chanVar) {
+		c.usage[v] = 0
+		if protected {
+			// The signature must not change, the variable is seen as bidirectional by its users
+			c.pinned[v] = true
 		}
+	}
 
-		if t.Dir != biDirectionalChan {
+	for _, field := range c.biDirChanFields(fn.Type.Params) {
+		if len(field.Names) == 0 { // unnamed chan param
 			continue
 		}
 
-		if len(param.Names) == 0 { // unnamed chan param
+		c.candidates = append(c.candidates, field)
+		for _, name := range field.Names {
+			v := chanVar{field: field, name: name}
+			c.vars[name.Obj] = v
+			track(v)
+		}
+	}
+
+	if fn.Type.Results == nil {
+		return
+	}
+
+	var results []chanVar
+	tracked := false
+	for _, field := range fn.Type.Results.List {
+		if !c.isBiDirChanField(field) || len(field.Names) != 0 {
+			// Named results are also local variables of the function, they are not narrowed
+			for range field.Names {
+				results = append(results, chanVar{})
+			}
+			if len(field.Names) == 0 {
+				results = append(results, chanVar{})
+			}
 			continue
 		}
 
-		biDirChans = append(biDirChans, param)
+		c.candidates = append(c.candidates, field)
+		v := chanVar{field: field}
+		track(v)
+		results = append(results, v)
+		tracked = true
 	}
 
-	return biDirChans
+	if tracked {
+		c.results[fn] = results
+	}
 }
 
-func (c *ChanDirectionChecker) biDirChanFuncs(pkg *ast.Package) map[*ast.FuncDecl][]*ast.Field {
-	bidirchanFuncs := make(map[*ast.FuncDecl][]*ast.Field)
+// collectStructCandidates registers the unexported bidirectional channel fields of the struct type declared by ts.
+// Unexported fields cannot be used outside of the package, so the package usage is their whole usage.
+// Fields of read only structs are tracked but pinned.
+func (c *ChanDirectionChecker) collectStructCandidates(ts *ast.TypeSpec, readOnly bool) {
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return
+	}
 
-	for _, file := range pkg.Files {
-		for _, decl := range file.Decls {
-			fn, ok := decl.(*ast.FuncDecl) // We only care for functions declaration
-			if !ok {
+	for _, field := range c.biDirChanFields(st.Fields) {
+		tracked := false
+		for _, name := range field.Names {
+			obj := c.info.Defs[name]
+			if name.IsExported() || obj == nil {
 				continue
 			}
 
-			chans := c.biDirChanParams(fn)
-			if len(chans) == 0 {
-				continue
+			v := chanVar{field: field, name: name}
+			c.fieldVars[obj] = v
+			c.usage[v] = 0
+			if readOnly {
+				c.pinned[v] = true
+			}
+			tracked = true
+		}
+
+		if tracked {
+			c.candidates = append(c.candidates, field)
+			if len(field.Names) > 1 {
+				c.structFields = append(c.structFields, field)
 			}
+		}
+	}
+}
 
-			bidirchanFuncs[fn] = chans
+// biDirChanFields returns the fields of list declared as bidirectional channels.
+func (c *ChanDirectionChecker) biDirChanFields(list *ast.FieldList) []*ast.Field {
+	var biDirChans []*ast.Field
+	for _, field := range list.List {
+		if c.isBiDirChanField(field) {
+			biDirChans = append(biDirChans, field)
 		}
 	}
 
-	return bidirchanFuncs
+	return biDirChans
 }
 
-func objInParams(obj *ast.Object, params []*ast.Field) bool {
-	if obj == nil {
+// isBiDirChanField reports whether field is a bidirectional channel which can be narrowed.
+// Besides channel types, e.g: `chan T`, named channel types and aliases, e.g: `type Jobs chan Job`, are narrowed
+// by replacing them with the channel type, provided its element type can be written where the field is declared.
+// Type parameters are never narrowed, since their constraint would need to change.
+func (c *ChanDirectionChecker) isBiDirChanField(field *ast.Field) bool {
+	dir, ok := c.declaredDir(field.Type)
+	if !ok || dir != biDirectionalChan {
 		return false
 	}
 
-	field, ok := obj.Decl.(*ast.Field)
+	if _, ok := field.Type.(*ast.ChanType); ok {
+		return true
+	}
+
+	_, ok = c.chanElemString(field.Type)
+	return ok
+}
+
+// declaredDir returns the direction of the channel type expr, or false if expr is not a channel type.
+func (c *ChanDirectionChecker) declaredDir(expr ast.Expr) (ast.ChanDir, bool) {
+	if t, ok := expr.(*ast.ChanType); ok {
+		return t.Dir, true
+	}
+
+	tv, ok := c.info.Types[expr]
+	if !ok || tv.Type == nil {
+		return 0, false
+	}
+
+	ch, ok := tv.Type.Underlying().(*types.Chan)
 	if !ok {
-		return false
+		return 0, false
 	}
 
-	return fieldInParams(field, params)
+	switch ch.Dir() {
+	case types.SendOnly:
+		return ast.SEND, true
+	case types.RecvOnly:
+		return ast.RECV, true
+	}
+	return biDirectionalChan, true
 }
 
-func fieldInParams(field *ast.Field, params []*ast.Field) bool {
-	for _, f := range params {
-		if field == f {
-			return true
+// chanElemString returns the element type of the channel type expr, as written in the file declaring expr.
+func (c *ChanDirectionChecker) chanElemString(expr ast.Expr) (string, bool) {
+	tv, ok := c.info.Types[expr]
+	if !ok || tv.Type == nil {
+		return "", false
+	}
+
+	ch, ok := tv.Type.Underlying().(*types.Chan)
+	if !ok || !c.expressible(ch.Elem()) {
+		return "", false
+	}
+
+	file := c.fileOf(expr)
+	if file == nil {
+		return "", false
+	}
+
+	expressible := true
+	qualifier := func(pkg *types.Package) string {
+		if pkg == c.tpkg {
+			return ""
 		}
+
+		for _, imp := range file.Imports {
+			if strings.Trim(imp.Path.Value, "\"`") != pkg.Path() {
+				continue
+			}
+			if imp.Name == nil {
+				return pkg.Name()
+			}
+			if imp.Name.Name == "." {
+				return ""
+			}
+			if imp.Name.Name != "_" {
+				return imp.Name.Name
+			}
+		}
+
+		// The package is not imported by the file
+		expressible = false
+		return pkg.Name()
+	}
+
+	elem := types.TypeString(ch.Elem(), qualifier)
+	return elem, expressible
+}
+
+// expressible reports whether t can be written outside of the package declaring it.
+func (c *ChanDirectionChecker) expressible(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.Basic:
+		return t.Kind() != types.Invalid
+	case *types.TypeParam:
+		return true
+	case *types.Pointer:
+		return c.expressible(t.Elem())
+	case *types.Slice:
+		return c.expressible(t.Elem())
+	case *types.Array:
+		return c.expressible(t.Elem())
+	case *types.Chan:
+		return c.expressible(t.Elem())
+	case *types.Map:
+		return c.expressible(t.Key()) && c.expressible(t.Elem())
+	case *types.Alias:
+		obj := t.Obj()
+		return obj.Pkg() == nil || obj.Pkg() == c.tpkg || obj.Exported()
+	case *types.Named:
+		obj := t.Obj()
+		if obj.Pkg() != nil && obj.Pkg() != c.tpkg && !obj.Exported() {
+			return false
+		}
+		if obj.Parent() != nil && obj.Parent() != obj.Pkg().Scope() && obj.Parent() != types.Universe {
+			// Types declared inside functions
+			return false
+		}
+		args := t.TypeArgs()
+		for i := 0; i < args.Len(); i++ {
+			if !c.expressible(args.At(i)) {
+				return false
+			}
+		}
+		return true
 	}
 	return false
 }
 
-// paramsUsedArgs returns the list of params used directly or inderectly by args.
-func paramsUsedInArgs(params []*ast.Field, args []ast.Expr) []*ast.Field {
-	var fields []*ast.Field
+// fileOf returns the file of the package being analyzed containing node.
+func (c *ChanDirectionChecker) fileOf(node ast.Node) *ast.File {
+	for _, file := range c.files {
+		if file.Pos() <= node.Pos() && node.End() <= file.End() {
+			return file
+		}
+	}
+	return nil
+}
+
+// chanTypeString returns the source code of the channel type of field with direction dir.
+func (c *ChanDirectionChecker) chanTypeString(field *ast.Field, dir ast.ChanDir) string {
+	if t, ok := field.Type.(*ast.ChanType); ok {
+		return c.exprString(&ast.ChanType{Dir: dir, Value: t.Value})
+	}
 
-	walk := func(node ast.Node) bool {
-		if id, ok := node.(*ast.Ident); ok && objInParams(id.Obj, params) {
-			field := id.Obj.Decl.(*ast.Field)
-			fields = append(fields, field)
+	elem, _ := c.chanElemString(field.Type)
+	switch dir {
+	case ast.SEND:
+		return "chan<- " + elem
+	case ast.RECV:
+		return "<-chan " + elem
+	}
+	return c.exprString(field.Type)
+}
+
+// fieldChanges returns the changes narrowing the channels declared by field.
+//
+// Names of a field sharing the same direction keep sharing the type, e.g: `a, b chan<- int`.
+// Otherwise the field is split into one parameter per name, e.g: `a chan<- int, b <-chan int`.
+func (c *ChanDirectionChecker) fieldChanges(field *ast.Field) []codechange.CodeChange {
+	vars := []chanVar{{field: field}}
+	if len(field.Names) != 0 {
+		vars = nil
+		for _, name := range field.Names {
+			vars = append(vars, chanVar{field: field, name: name})
 		}
-		return true
 	}
 
-	for _, arg := range args {
-		ast.Inspect(arg, walk)
+	dirs := make([]ast.ChanDir, len(vars))
+	split := false
+	for i, v := range vars {
+		dirs[i] = biDirectionalChan
+		if usage, ok := c.usage[v]; ok && !c.pinned[v] && (usage == ast.SEND || usage == ast.RECV) {
+			dirs[i] = usage
+		}
+		split = split || dirs[i] != dirs[0]
+	}
+
+	var changes []codechange.CodeChange
+	last := len(vars) - 1
+	if split {
+		// Every name but the last one gets its own type, the last one keeps the original type.
+		for i, v := range vars[:last] {
+			change := c.insertion(v.name.End(), " "+c.chanTypeString(field, dirs[i]))
+			change.Message = changeMessage(vars[i:i+1], dirs[i], c.chanTypeString(field, dirs[i]))
+			changes = append(changes, change)
+		}
+	}
+
+	// lastVars are the variables sharing the type of the field once changed
+	lastVars := vars
+	if split {
+		lastVars = vars[last:]
+	}
+
+	var change codechange.CodeChange
+	t, ok := field.Type.(*ast.ChanType)
+	switch {
+	case dirs[last] == biDirectionalChan:
+		return changes
+	case !ok:
+		// Named channel types are replaced by the channel type, e.g: `Jobs` -> `<-chan Job`
+		change = c.replacement(field.Type, c.chanTypeString(field, dirs[last]))
+	case dirs[last] == ast.SEND:
+		// `chan T` -> `chan<- T`
+		change = c.insertion(t.Begin+token.Pos(len(token.CHAN.String())), token.ARROW.String())
+	default:
+		// `chan T` -> `<-chan T`
+		change = c.insertion(t.Begin, token.ARROW.String())
 	}
+	change.Message = changeMessage(lastVars, dirs[last], c.chanTypeString(field, dirs[last]))
 
-	return fields
+	return append(changes, change)
 }
 
-// funcsChanParamsUsage returns a mapping of how chan parameters are being used inside function fn.
-func (c *ChanDirectionChecker) funcsChanParamsUsage(fn ast.Node, params []*ast.Field) map[*ast.Field]ast.ChanDir {
-	m := make(map[*ast.Field]ast.ChanDir)
+// changeMessage explains the change of the type of vars to typ, a channel of direction dir.
+func changeMessage(vars []chanVar, dir ast.ChanDir, typ string) string {
+	var names []string
+	for _, v := range vars {
+		if v.name != nil {
+			names = append(names, v.name.Name)
+		}
+	}
 
-	walkFunc := func(node ast.Node) bool {
-		// Mark any channel parameter used in function call as bidirectional
-		if callExpr, ok := node.(*ast.CallExpr); ok {
-			for _, field := range paramsUsedInArgs(params, callExpr.Args) {
-				if fieldInParams(field, params) {
-					m[field] = m[field] | biDirectionalChan
+	subject := "the result channel is"
+	switch {
+	case len(names) == 1:
+		subject = "channel " + names[0] + " is"
+	case len(names) > 1:
+		subject = "channels " + strings.Join(names, ", ") + " are"
+	}
+
+	switch dir {
+	case ast.SEND:
+		return fmt.Sprintf("%s only used to send, its type can be %s", subject, typ)
+	case ast.RECV:
+		return fmt.Sprintf("%s only used to receive, its type can be %s", subject, typ)
+	}
+	return fmt.Sprintf("%s used to send and receive, its type stays %s while the other names of its declaration are narrowed", subject, typ)
+}
+
+// insertion returns a change adding text at pos.
+func (c *ChanDirectionChecker) insertion(pos token.Pos, text string) codechange.CodeChange {
+	position := c.fset.Position(pos)
+	return codechange.CodeChange{
+		Filename: position.Filename,
+		Line:     position.Line,
+		Column:   position.Column,
+		Offset:   position.Offset,
+		Add:      []byte(text),
+		Source:   chanDirectionSource,
+	}
+}
+
+// replacement returns a change replacing node by text.
+func (c *ChanDirectionChecker) replacement(node ast.Node, text string) codechange.CodeChange {
+	change := c.insertion(node.Pos(), text)
+	change.Delete = int(node.End() - node.Pos())
+	return change
+}
+
+// exprString returns the source code of expr.
+func (c *ChanDirectionChecker) exprString(expr ast.Expr) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, c.fset, expr)
+	return buf.String()
+}
+
+// propagateUsage computes the fixpoint of the channel usages through the recorded flows.
+//
+// A variable passed to another function inherits the direction the callee parameter will end up with.
+// Usages only grow, so recursive and mutually recursive functions converge.
+// Variables that won't be narrowed are then pinned as bidirectional, since narrowing their users
+// would not compile anymore, and the fixpoint is computed again until no more variables get pinned.
+//
+// It reports false if the context of the checker is done before the fixpoint is reached.
+func (c *ChanDirectionChecker) propagateUsage() bool {
+	for {
+		for changed := true; changed; {
+			if c.ctx.Err() != nil {
+				return false
+			}
+			changed = false
+			for _, flow := range c.flows {
+				usage := c.usage[flow.from] | c.varDirection(flow.to)
+				if usage != c.usage[flow.from] {
+					c.usage[flow.from] = usage
+					changed = true
 				}
 			}
 		}
 
-		// Send to channel
-		if sendStmt, ok := node.(*ast.SendStmt); ok {
-			if id, ok := sendStmt.Chan.(*ast.Ident); ok && objInParams(id.Obj, params) { // We only care when the channel is an identifier
-				field := id.Obj.Decl.(*ast.Field)
-				m[field] = m[field] | ast.SEND
+		pinned := false
+		for v, usage := range c.usage {
+			if v.field == nil || c.pinned[v] || usage == ast.SEND || usage == ast.RECV {
+				continue
 			}
+			c.pinned[v] = true
+			pinned = true
 		}
 
-		// Read from channel
-		if unaryExpr, ok := node.(*ast.UnaryExpr); ok {
-			op := unaryExpr.Op.String()
-			if op == "<-" {
-				for _, id := range unaryExprReadChannels(unaryExpr) {
-					if objInParams(id.Obj, params) {
-						field := id.Obj.Decl.(*ast.Field)
-						m[field] = m[field] | ast.RECV
-					}
-				}
-			}
+		for _, field := range c.structFields {
+			pinned = c.pinDisagreeingNames(field) || pinned
 		}
 
-		// Range over a channel
-		if rngStmt, ok := node.(*ast.RangeStmt); ok {
-			if ident, ok := rngStmt.X.(*ast.Ident); ok && objInParams(ident.Obj, params) {
-				field := ident.Obj.Decl.(*ast.Field)
-				m[field] = m[field] | ast.RECV
+		if !pinned {
+			return true
+		}
+	}
+}
+
+// pinDisagreeingNames pins all names of field if they don't share the same direction.
+// It reports whether new names got pinned.
+func (c *ChanDirectionChecker) pinDisagreeingNames(field *ast.Field) bool {
+	var dir ast.ChanDir
+	agree := true
+	for i, name := range field.Names {
+		v := chanVar{field: field, name: name}
+		d := ast.ChanDir(biDirectionalChan)
+		if usage, ok := c.usage[v]; ok && !c.pinned[v] {
+			d = usage
+		}
+		if i != 0 && d != dir {
+			agree = false
+		}
+		dir = d
+	}
+
+	if agree {
+		return false
+	}
+
+	pinned := false
+	for _, name := range field.Names {
+		v := chanVar{field: field, name: name}
+		if _, ok := c.usage[v]; ok && !c.pinned[v] {
+			c.pinned[v] = true
+			pinned = true
+		}
+	}
+	return pinned
+}
+
+// varDirection returns the direction a channel variable has, or will have once the changes are applied.
+func (c *ChanDirectionChecker) varDirection(v chanVar) ast.ChanDir {
+	if v.field == nil {
+		// Local variables types are inferred, they only require the direction they are used with
+		return c.usage[v]
+	}
+
+	dir, ok := c.declaredDir(v.field.Type)
+	if !ok {
+		return biDirectionalChan
+	}
+
+	if dir != biDirectionalChan {
+		return dir
+	}
+
+	usage, ok := c.usage[v]
+	if !ok || c.pinned[v] {
+		return biDirectionalChan
+	}
+
+	return usage
+}
+
+// funcDecls returns the functions and methods declared in pkg, indexed by their object.
+func funcDecls(pkg *ast.Package, info *types.Info) map[types.Object]*ast.FuncDecl {
+	decls := make(map[types.Object]*ast.FuncDecl)
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if obj := info.Defs[fn.Name]; obj != nil {
+				decls[obj] = fn
 			}
 		}
+	}
+	return decls
+}
+
+// calleeDecl returns the declaration of the package function or method called by call, if any.
+func (c *ChanDirectionChecker) calleeDecl(call *ast.CallExpr) *ast.FuncDecl {
+	var id *ast.Ident
+	switch fn := unindex(unparen(call.Fun)).(type) {
+	case *ast.Ident:
+		id = fn
+	case *ast.SelectorExpr:
+		// e.g: `t.Method()`
+		id = fn.Sel
+	default:
+		return nil
+	}
+
+	return c.funcDecls[origin(c.info.Uses[id])]
+}
+
+// calleeParams returns the parameters of the package function called by call, one per argument.
+// It returns nil if the callee cannot be resolved.
+func (c *ChanDirectionChecker) calleeParams(call *ast.CallExpr) []chanVar {
+	var ftype *ast.FuncType
+	if fn, ok := unparen(call.Fun).(*ast.FuncLit); ok {
+		// e.g: `func(ch chan int) {...}(ch)`
+		ftype = fn.Type
+	} else if decl := c.calleeDecl(call); decl != nil {
+		ftype = decl.Type
+	} else {
+		return nil
+	}
+
+	var params []chanVar
+	for _, field := range ftype.Params.List {
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			// Variadic arguments are not tracked
+			break
+		}
+
+		if len(field.Names) == 0 {
+			params = append(params, chanVar{field: field})
+			continue
+		}
+		for _, name := range field.Names {
+			params = append(params, chanVar{field: field, name: name})
+		}
+	}
 
-		// Close of a channel
-		if callExpr, ok := node.(*ast.CallExpr); ok && isBuiltinCloseCall(callExpr) {
-			if ident, ok := callExpr.Args[0].(*ast.Ident); ok && objInParams(ident.Obj, params) {
-				field := ident.Obj.Decl.(*ast.Field)
-				m[field] = m[field] | biDirectionalChan
+	if call.Ellipsis.IsValid() && len(params) > 0 {
+		// e.g: `fn(a, b, rest...)`
+		params = params[:len(params)-1]
+	}
+
+	return params
+}
+
+// unindex returns the generic function of an explicit instantiation, e.g: `fn[int]` -> `fn`.
+func unindex(expr ast.Expr) ast.Expr {
+	switch e := expr.(type) {
+	case *ast.IndexExpr:
+		return e.X
+	case *ast.IndexListExpr:
+		return e.X
+	}
+	return expr
+}
+
+// origin returns the generic object of obj if obj is a method or a field of an instantiated generic type.
+func origin(obj types.Object) types.Object {
+	switch o := obj.(type) {
+	case *types.Func:
+		return o.Origin()
+	case *types.Var:
+		return o.Origin()
+	}
+	return obj
+}
+
+func unparen(expr ast.Expr) ast.Expr {
+	for {
+		p, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = p.X
+	}
+}
+
+// collectUsages computes how the tracked channel variables are used in pkg.
+//
+// Every reference to a channel variable is classified by the expression or statement using it:
+// identifiers for parameters and local variables, selectors for struct fields and calls for results.
+// Any usage not known to be safe with a directional channel, like storing the channel in a struct
+// or sending it over another channel, marks the channel as bidirectional.
+func (c *ChanDirectionChecker) collectUsages(pkg *ast.Package) {
+	// stack holds the path from the file to the current node
+	var stack []ast.Node
+	walkFunc := func(node ast.Node) bool {
+		if node == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, node)
+
+		switch n := node.(type) {
+		case *ast.Ident:
+			if v, ok := c.vars[n.Obj]; ok && n.Obj != nil && v.name != n {
+				c.usage[v] = c.usage[v] | c.chanUsage(v, stack)
+			}
+
+		case *ast.SelectorExpr:
+			// e.g: `s.ch`
+			if v, ok := c.fieldVars[origin(c.info.Uses[n.Sel])]; ok {
+				c.usage[v] = c.usage[v] | c.chanUsage(v, stack)
+			}
+
+		case *ast.CallExpr:
+			// e.g: `<-gen()`
+			if results, ok := c.results[c.calleeDecl(n)]; ok {
+				c.resultsUsage(results, stack)
 			}
 		}
 
 		return true
 	}
 
-	fnBody := fn.(*ast.FuncDecl).Body
-	ast.Inspect(fnBody, walkFunc)
+	for _, file := range pkg.Files {
+		ast.Inspect(file, walkFunc)
+	}
+}
+
+// resultsUsage records how the results of the call at the top of stack are used.
+func (c *ChanDirectionChecker) resultsUsage(results []chanVar, stack []ast.Node) {
+	if len(results) == 1 {
+		c.usage[results[0]] = c.usage[results[0]] | c.chanUsage(results[0], stack)
+		return
+	}
+
+	// Multiple results can only be assigned to new variables, e.g: `ch, err := gen()`
+	call := stack[len(stack)-1]
+	var lhs []ast.Expr
+	switch parent := stack[len(stack)-2].(type) {
+	case *ast.AssignStmt:
+		if parent.Tok == token.DEFINE && len(parent.Rhs) == 1 {
+			lhs = parent.Lhs
+		}
+	case *ast.ValueSpec:
+		if parent.Type == nil && len(parent.Values) == 1 {
+			for _, name := range parent.Names {
+				lhs = append(lhs, name)
+			}
+		}
+	}
+
+	for i, v := range results {
+		if v == (chanVar{}) {
+			continue
+		}
 
-	return m
+		usage := ast.ChanDir(biDirectionalChan)
+		if len(lhs) == len(results) {
+			usage = c.defineLocal(v, lhs[i], call)
+		}
+		c.usage[v] = c.usage[v] | usage
+	}
 }
 
-// isBuiltinCloseCall checks if the call to `close` is a call to the builtin `call` function
-func isBuiltinCloseCall(call *ast.CallExpr) bool {
-	ident, ok := call.Fun.(*ast.Ident)
-	if !ok { // Maybe anon function call
-		return false
+// defineLocal records the channel variable v being assigned to the local variable declared by lhs.
+// It returns how v is used by the assignment.
+func (c *ChanDirectionChecker) defineLocal(v chanVar, lhs ast.Expr, value ast.Node) ast.ChanDir {
+	id, ok := lhs.(*ast.Ident)
+	if !ok {
+		return biDirectionalChan
+	}
+
+	if id.Name == "_" {
+		return 0
+	}
+
+	if id.Obj == nil {
+		return biDirectionalChan
+	}
+
+	// With `a, b := ...` some variables may already be declared
+	declared := false
+	switch decl := id.Obj.Decl.(type) {
+	case *ast.AssignStmt:
+		declared = containsExpr(decl.Rhs, value)
+	case *ast.ValueSpec:
+		declared = containsExpr(decl.Values, value)
+	}
+	if !declared {
+		return biDirectionalChan
+	}
+
+	local := chanVar{name: id}
+	c.vars[id.Obj] = local
+	if _, ok := c.usage[local]; !ok {
+		c.usage[local] = 0
 	}
+	c.flows = append(c.flows, chanFlow{from: v, to: local})
 
-	return ident.Name == "close" && ident.Obj == nil // if obj is not nil, then close is overwritten by another one.
+	return 0
 }
 
-// unaryExprReadChannels returns the list of channel params a read (<-) unary expression depends on.
-func unaryExprReadChannels(unaryExpr *ast.UnaryExpr) []*ast.Ident {
-	switch x := unaryExpr.X.(type) {
-	case *ast.Ident:
-		// e.g: `<-channel`
-		return []*ast.Ident{x}
+func containsExpr(exprs []ast.Expr, node ast.Node) bool {
+	for _, expr := range exprs {
+		if expr == node {
+			return true
+		}
+	}
+	return false
+}
+
+// chanUsage returns how the channel variable v, referenced by the expression at the top of stack, is used.
+func (c *ChanDirectionChecker) chanUsage(v chanVar, stack []ast.Node) ast.ChanDir {
+	// Find the first parent which is not a parenthesis, e.g: `(ch) <- 1`
+	var child ast.Node = stack[len(stack)-1]
+	i := len(stack) - 2
+	for ; i >= 0; i-- {
+		p, ok := stack[i].(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		child = p
+	}
+	if i < 0 {
+		return biDirectionalChan
+	}
+
+	switch parent := stack[i].(type) {
+	case *ast.SendStmt:
+		// Send to channel, e.g: `ch <- 1` or `case ch <- 1:`
+		// Sending the channel itself over another channel, e.g: `out <- ch`, is aliasing
+		if parent.Chan == child {
+			return ast.SEND
+		}
+
+	case *ast.UnaryExpr:
+		// Read from channel, e.g: `<-ch`, `v := <-ch` or `case v, ok := <-ch:`
+		// Taking the address of the channel, e.g: `&ch`, is aliasing
+		if parent.Op == token.ARROW {
+			return ast.RECV
+		}
+
+	case *ast.RangeStmt:
+		// Range over a channel, e.g: `for v := range ch`
+		if parent.X == child {
+			return ast.RECV
+		}
+
+	case *ast.BinaryExpr:
+		// Comparison to nil, e.g: `ch != nil`
+		other := parent.X
+		if other == child {
+			other = parent.Y
+		}
+		if id, ok := unparen(other).(*ast.Ident); ok && id.Name == "nil" && id.Obj == nil {
+			return 0
+		}
+
+	case *ast.AssignStmt:
+		// Assigning a bidirectional channel, or nil, to the variable, e.g: `s.ch = make(chan int)`.
+		// Directional channels assigned to it would already be rejected by the compiler.
+		if containsExpr(parent.Lhs, child) {
+			return 0
+		}
+
+		// Aliasing to a new local variable, e.g: `ch := s.ch`
+		for j, rhs := range parent.Rhs {
+			if rhs == child && parent.Tok == token.DEFINE && len(parent.Lhs) == len(parent.Rhs) {
+				return c.defineLocal(v, parent.Lhs[j], child)
+			}
+		}
+
+	case *ast.ValueSpec:
+		// Aliasing to a new local variable, e.g: `var ch = s.ch`
+		for j, value := range parent.Values {
+			if value == child && parent.Type == nil && len(parent.Names) == len(parent.Values) {
+				return c.defineLocal(v, parent.Names[j], child)
+			}
+		}
+
 	case *ast.CallExpr:
-		// e.g: `<-fn()`
-		// todo: handle
+		return c.callArgUsage(v, parent, child)
 	}
-	return nil
+
+	return biDirectionalChan
+}
+
+// callArgUsage returns how the channel variable v, used as the argument arg of call, is used.
+func (c *ChanDirectionChecker) callArgUsage(v chanVar, call *ast.CallExpr, arg ast.Node) ast.ChanDir {
+	// Conversion to a channel type, e.g: `(<-chan int)(ch)` or `Jobs(ch)`
+	if tv, ok := c.info.Types[call.Fun]; ok && tv.IsType() {
+		if dir, ok := c.declaredDir(call.Fun); ok {
+			return dir
+		}
+		return biDirectionalChan
+	}
+
+	switch {
+	case c.isBuiltinCall(call, "len"), c.isBuiltinCall(call, "cap"):
+		// Valid whatever the direction of the channel is
+		return 0
+	case c.isBuiltinCall(call, "close"):
+		// Closing is only valid on channels which can send
+		return ast.SEND
+	}
+
+	// A channel passed as is to a package function inherits the callee parameter direction.
+	// Any other channel used in function call is marked as bidirectional
+	callee := c.calleeParams(call)
+	for i, a := range call.Args {
+		if a == arg && i < len(callee) {
+			c.flows = append(c.flows, chanFlow{from: v, to: callee[i]})
+			return 0
+		}
+	}
+
+	return biDirectionalChan
+}
+
+// isBuiltinCall checks if call is a call to the builtin function name.
+func (c *ChanDirectionChecker) isBuiltinCall(call *ast.CallExpr, name string) bool {
+	ident, ok := unparen(call.Fun).(*ast.Ident)
+	if !ok { // Maybe anon function call
+		return false
+	}
+
+	// The builtin may be overwritten by another declaration
+	_, ok = c.info.Uses[ident].(*types.Builtin)
+	return ok && ident.Name == name
 }
@@ -0,0 +1,319 @@
+package checker
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ChanDirectionMode defines which functions ChanDirectionChecker is allowed to change.
+type ChanDirectionMode int
+
+const (
+	// ChanDirectionAll allows changing any function, exported or not.
+	ChanDirectionAll ChanDirectionMode = iota
+
+	// ChanDirectionInternal allows changing exported functions of internal and main packages only,
+	// since they cannot be imported by other modules.
+	ChanDirectionInternal
+
+	// ChanDirectionUnexported only allows changing unexported functions and methods.
+	ChanDirectionUnexported
+)
+
+// pkgFiles returns the files of pkg sorted by filename.
+func pkgFiles(pkg *ast.Package) []*ast.File {
+	var filenames []string
+	for filename := range pkg.Files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	var files []*ast.File
+	for _, filename := range filenames {
+		files = append(files, pkg.Files[filename])
+	}
+	return files
+}
+
+// syncImporter serializes the imports of an importer shared by packages type checked concurrently.
+// The packages imported are cached by the importer, so imports are cheap once done.
+type syncImporter struct {
+	mu  sync.Mutex
+	imp types.Importer
+}
+
+func (i *syncImporter) Import(path string) (*types.Package, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.imp.Import(path)
+}
+
+// typeCheck type checks the files of the package name and returns the collected type information.
+// Type checking goes on after type errors, like unresolved imports: the returned information is then partial,
+// and the first error is returned.
+func typeCheck(fset *token.FileSet, imp types.Importer, files []*ast.File, name string) (*types.Package, *types.Info, error) {
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	var err error
+	conf := types.Config{
+		Importer: imp,
+		Error: func(e error) {
+			if err == nil {
+				err = e
+			}
+		},
+	}
+	tpkg, _ := conf.Check(name, fset, files, info)
+
+	return tpkg, info, err
+}
+
+// protectedFuncs returns the functions of pkg whose signature must not change.
+func (c *ChanDirectionChecker) protectedFuncs(pkg *ast.Package, tpkg *types.Package) map[*ast.FuncDecl]bool {
+	info, decls := c.info, c.funcDecls
+
+	protected := make(map[*ast.FuncDecl]bool)
+	for _, fn := range decls {
+		if !c.modeAllows(pkg, fn) {
+			protected[fn] = true
+		}
+	}
+
+	// Changing the signature of a function used as a value breaks the assignment
+	for obj := range funcsUsedAsValue(pkg, info) {
+		if fn, ok := decls[obj]; ok {
+			protected[fn] = true
+		}
+	}
+
+	// Changing the signature of an interface method makes its type not implementing the interface anymore
+	for obj := range interfacesMethods(tpkg, info) {
+		if fn, ok := decls[obj]; ok {
+			protected[fn] = true
+		}
+	}
+
+	// A function with the same signature as a function type is likely to be used as such
+	sigs := funcTypesSignatures(pkg, tpkg, info)
+	for obj, fn := range decls {
+		sig, ok := obj.Type().(*types.Signature)
+		if !ok {
+			continue
+		}
+		for _, s := range sigs {
+			if types.Identical(sig, s) {
+				protected[fn] = true
+				break
+			}
+		}
+	}
+
+	return protected
+}
+
+// modeAllows reports whether the checker mode allows changing the signature of fn.
+func (c *ChanDirectionChecker) modeAllows(pkg *ast.Package, fn *ast.FuncDecl) bool {
+	switch c.mode {
+	case ChanDirectionUnexported:
+		return !fn.Name.IsExported()
+	case ChanDirectionInternal:
+		return !fn.Name.IsExported() || isInternalPackage(pkg)
+	}
+	return true
+}
+
+// isInternalPackage reports whether pkg cannot be imported by other modules.
+func isInternalPackage(pkg *ast.Package) bool {
+	if pkg.Name == "main" {
+		return true
+	}
+
+	for filename := range pkg.Files {
+		for _, elem := range strings.Split(filepath.ToSlash(filepath.Dir(filename)), "/") {
+			if elem == "internal" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// funcsUsedAsValue returns the functions and methods referenced anywhere else than as the callee of a call.
+func funcsUsedAsValue(pkg *ast.Package, info *types.Info) map[types.Object]bool {
+	values := make(map[types.Object]bool)
+	called := make(map[ast.Expr]bool)
+
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.CallExpr:
+			called[unindex(unparen(n.Fun))] = true
+		case *ast.SelectorExpr:
+			// e.g: `t.Method` or `pkg.Func`
+			if fn, ok := info.Uses[n.Sel].(*types.Func); ok && !called[n] {
+				values[fn.Origin()] = true
+			}
+			ast.Inspect(n.X, visit)
+			return false
+		case *ast.Ident:
+			if fn, ok := info.Uses[n].(*types.Func); ok && !called[n] {
+				values[fn] = true
+			}
+		}
+		return true
+	}
+
+	for _, file := range pkg.Files {
+		ast.Inspect(file, visit)
+	}
+
+	return values
+}
+
+// interfacesMethods returns the methods of the package types used to implement an interface.
+// Interfaces declared in the package, in its imports and interfaces literals are considered.
+func interfacesMethods(tpkg *types.Package, info *types.Info) map[types.Object]bool {
+	var ifaces []*types.Interface
+	seen := make(map[*types.Interface]bool)
+	addIface := func(t types.Type) {
+		iface, ok := t.Underlying().(*types.Interface)
+		if !ok || iface.NumMethods() == 0 || seen[iface] {
+			return
+		}
+		seen[iface] = true
+		ifaces = append(ifaces, iface)
+	}
+
+	var named, generic []*types.Named
+	for _, obj := range info.Defs {
+		tn, ok := obj.(*types.TypeName)
+		if !ok {
+			continue
+		}
+		addIface(tn.Type())
+		if n, ok := tn.Type().(*types.Named); ok {
+			if n.TypeParams().Len() == 0 {
+				named = append(named, n)
+			} else {
+				generic = append(generic, n)
+			}
+		}
+	}
+
+	for _, tv := range info.Types {
+		if tv.Type != nil {
+			addIface(tv.Type)
+		}
+	}
+
+	if tpkg != nil {
+		for _, imp := range tpkg.Imports() {
+			scope := imp.Scope()
+			for _, name := range scope.Names() {
+				if tn, ok := scope.Lookup(name).(*types.TypeName); ok && tn.Exported() {
+					addIface(tn.Type())
+				}
+			}
+		}
+	}
+
+	methods := make(map[types.Object]bool)
+
+	// Implementation by generic types depends on the type arguments,
+	// their methods with the same name as an interface method are protected.
+	ifaceMethodNames := make(map[string]bool)
+	for _, iface := range ifaces {
+		for i := 0; i < iface.NumMethods(); i++ {
+			ifaceMethodNames[iface.Method(i).Name()] = true
+		}
+	}
+	for _, n := range generic {
+		for i := 0; i < n.NumMethods(); i++ {
+			if m := n.Method(i); ifaceMethodNames[m.Name()] {
+				methods[m] = true
+			}
+		}
+	}
+
+	for _, n := range named {
+		if types.IsInterface(n) {
+			continue
+		}
+
+		for _, t := range []types.Type{n, types.NewPointer(n)} {
+			for _, iface := range ifaces {
+				if !types.Implements(t, iface) {
+					continue
+				}
+
+				for i := 0; i < iface.NumMethods(); i++ {
+					m := iface.Method(i)
+					obj, _, _ := types.LookupFieldOrMethod(t, false, m.Pkg(), m.Name())
+					if fn, ok := obj.(*types.Func); ok {
+						methods[fn] = true
+					}
+				}
+			}
+		}
+	}
+
+	return methods
+}
+
+// funcTypesSignatures returns the signatures of the function types declared or referenced in the package.
+// Signatures of functions declarations, literals and interfaces methods are not included.
+func funcTypesSignatures(pkg *ast.Package, tpkg *types.Package, info *types.Info) []*types.Signature {
+	var sigs []*types.Signature
+	addSig := func(t types.Type) {
+		if sig, ok := t.Underlying().(*types.Signature); ok {
+			sigs = append(sigs, sig)
+		}
+	}
+
+	own := make(map[*ast.FuncType]bool)
+	for _, file := range pkg.Files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.FuncDecl:
+				own[n.Type] = true
+			case *ast.FuncLit:
+				own[n.Type] = true
+			case *ast.InterfaceType:
+				// Interfaces methods are handled by interfacesMethods
+				for _, m := range n.Methods.List {
+					if ft, ok := m.Type.(*ast.FuncType); ok {
+						own[ft] = true
+					}
+				}
+			case *ast.FuncType:
+				if tv, ok := info.Types[n]; ok && !own[n] && tv.Type != nil {
+					addSig(tv.Type)
+				}
+			}
+			return true
+		})
+	}
+
+	if tpkg != nil {
+		for _, imp := range tpkg.Imports() {
+			scope := imp.Scope()
+			for _, name := range scope.Names() {
+				if tn, ok := scope.Lookup(name).(*types.TypeName); ok && tn.Exported() {
+					addSig(tn.Type())
+				}
+			}
+		}
+	}
+
+	return sigs
+}
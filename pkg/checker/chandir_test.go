@@ -1,11 +1,20 @@
 package checker
 
 import (
+	"context"
+	"fmt"
+	goast "go/ast"
+	"go/parser"
 	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/segflow/contribuehub/pkg/ast"
+	"github.com/segflow/contribuehub/pkg/codechange"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,8 +26,9 @@ func TestRecvOnlyChannel(t *testing.T) {
 	} 
 	`
 
-	checker := NewChanDirectionChecker(token.NewFileSet())
-	checker.SetPackages(ast.PackagesFromCode(code))
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
 
 	// if
 	reports := checker.CodeChanges()
@@ -32,11 +42,13 @@ func TestSendOnlyChannel(t *testing.T) {
 	package test
 	func A(a chan int) {
 		b := <-a
+		_ = b
 	}
 	`
 
-	checker := NewChanDirectionChecker(token.NewFileSet())
-	checker.SetPackages(ast.PackagesFromCode(code))
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
 
 	// if
 	reports := checker.CodeChanges()
@@ -54,8 +66,9 @@ func TestSendRecvChannel(t *testing.T) {
 	}
 	`
 
-	checker := NewChanDirectionChecker(token.NewFileSet())
-	checker.SetPackages(ast.PackagesFromCode(code))
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
 
 	// if
 	reports := checker.CodeChanges()
@@ -68,13 +81,15 @@ func TestReadCloseChannel(t *testing.T) {
 	code := `
 	package test
 	func A(a chan int) {
-		b := <-1
+		b := <-a
+		_ = b
 		close(a)
 	}
 	`
 
-	checker := NewChanDirectionChecker(token.NewFileSet())
-	checker.SetPackages(ast.PackagesFromCode(code))
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
 
 	// if
 	reports := checker.CodeChanges()
@@ -83,9 +98,36 @@ func TestReadCloseChannel(t *testing.T) {
 	assert.Len(t, reports, 0)
 }
 
+func TestSendCloseChannel(t *testing.T) {
+	code := `
+	package test
+	func produce(ch chan int) {
+		ch <- 1
+		close(ch)
+	}
+	func closeAll(chs chan int) {
+		close(chs)
+	}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	if assert.Len(t, reports, 2) {
+		assert.Equal(t, "<-", string(reports[0].Add))
+		assert.Equal(t, 3, reports[0].Line)
+		assert.Equal(t, 7, reports[1].Line)
+	}
+}
+
 func TestReadCustomCloseChannel(t *testing.T) {
-	// Since we mark any channel used in any local function call as bidrectional for now,
-	// any close(CH) will mark CH as bidirectional
+	// close is a function of the package here, not the builtin: a is passed as an interface{},
+	// its direction is kept, unlike with the builtin close which only narrows it to send only
 	code := `
 	package test
 
@@ -96,8 +138,9 @@ func TestReadCustomCloseChannel(t *testing.T) {
 	}
 	`
 
-	checker := NewChanDirectionChecker(token.NewFileSet())
-	checker.SetPackages(ast.PackagesFromCode(code))
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
 
 	// if
 	reports := checker.CodeChanges()
@@ -117,8 +160,9 @@ func TestSelectChannel(t *testing.T) {
 	}
 	`
 
-	checker := NewChanDirectionChecker(token.NewFileSet())
-	checker.SetPackages(ast.PackagesFromCode(code))
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
 
 	// if
 	reports := checker.CodeChanges()
@@ -132,12 +176,13 @@ func TestRangeChannel(t *testing.T) {
 	package test
 
 	func A(a chan int) {
-		for b := range a {}
+		for range a {}
 	}
 	`
 
-	checker := NewChanDirectionChecker(token.NewFileSet())
-	checker.SetPackages(ast.PackagesFromCode(code))
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
 
 	// if
 	reports := checker.CodeChanges()
@@ -155,8 +200,9 @@ func TestNotUsedChannel(t *testing.T) {
 	}
 	`
 
-	checker := NewChanDirectionChecker(token.NewFileSet())
-	checker.SetPackages(ast.PackagesFromCode(code))
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
 
 	// if
 	reports := checker.CodeChanges()
@@ -176,8 +222,9 @@ func TestClosureFuncSendChannel(t *testing.T) {
 	}
 	`
 
-	checker := NewChanDirectionChecker(token.NewFileSet())
-	checker.SetPackages(ast.PackagesFromCode(code))
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
 
 	// if
 	reports := checker.CodeChanges()
@@ -191,44 +238,838 @@ func TestClosureFuncSendRecvChannel(t *testing.T) {
 	code := `
 	package test
 
-	func A(a chan int) {
+	func A(a chan int, b chan int) {
 		func (){
 			a <- 2
-		}
+			b <- 2
+		}()
 		v := <- a
+		_ = v
 	}
 	`
 
-	checker := NewChanDirectionChecker(token.NewFileSet())
-	checker.SetPackages(ast.PackagesFromCode(code))
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
 
 	// if
 	reports := checker.CodeChanges()
 	spew.Dump(reports)
 
-	// then
-	assert.Len(t, reports, 0)
+	// then a is both sent to, in the closure, and received from, b is only sent to
+	if assert.Len(t, reports, 1) {
+		assert.Contains(t, applyChanges(code, reports), "func A(a chan int, b chan<- int) {")
+	}
 }
 
 func TestChanInFuncCallChannel(t *testing.T) {
 	code := `
 	package test
 
-	func A(a chan int) {
+	func A(a chan int, c chan int) {
 		func (b chan int){
 			b <- 2
 		}(a)
 		v := <- a
+		_ = v
+		c <- 2
 	}
 	`
 
-	checker := NewChanDirectionChecker(token.NewFileSet())
-	checker.SetPackages(ast.PackagesFromCode(code))
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
 
 	// if
 	reports := checker.CodeChanges()
 	spew.Dump(reports)
 
+	// then a, passed to the func literal, keeps its direction, c is only sent to
+	if assert.Len(t, reports, 1) {
+		assert.Contains(t, applyChanges(code, reports), "func A(a chan int, c chan<- int) {")
+	}
+}
+
+func TestHelperChainChannel(t *testing.T) {
+	code := `
+	package test
+
+	func A(a chan int) {
+		B(a)
+	}
+
+	func B(b chan int) {
+		C(b)
+	}
+
+	func C(c chan int) {
+		c <- 2
+	}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	assert.Len(t, reports, 3)
+}
+
+func TestDeclaredDirectionCalleeChannel(t *testing.T) {
+	code := `
+	package test
+
+	func A(a chan int) {
+		B(a)
+	}
+
+	func B(b <-chan int) {
+		<-b
+	}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	assert.Len(t, reports, 1)
+}
+
+func TestConflictingCalleesChannel(t *testing.T) {
+	code := `
+	package test
+
+	func A(a chan int) {
+		B(a)
+		C(a)
+	}
+
+	func B(b chan int) {
+		b <- 2
+	}
+
+	func C(c chan int) {
+		<-c
+	}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	assert.Len(t, reports, 2)
+}
+
+func TestUnusedCalleeParamChannel(t *testing.T) {
+	// B's parameter is left untouched, so passing a narrowed channel to it would not compile.
+	code := `
+	package test
+
+	func A(a chan int) {
+		a <- 2
+		B(a)
+	}
+
+	func B(b chan int) {}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
 	// then
 	assert.Len(t, reports, 0)
 }
+
+func TestRecursiveChannel(t *testing.T) {
+	code := `
+	package test
+
+	func A(a chan int, n int) {
+		if n == 0 {
+			return
+		}
+		a <- n
+		A(a, n-1)
+	}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	assert.Len(t, reports, 1)
+}
+
+func TestMutuallyRecursiveChannel(t *testing.T) {
+	code := `
+	package test
+
+	func A(a chan int) {
+		<-a
+		B(a)
+	}
+
+	func B(b chan int) {
+		A(b)
+	}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	assert.Len(t, reports, 2)
+}
+
+func TestMethodCallChannel(t *testing.T) {
+	// Methods calls are resolved using the type information.
+	code := `
+	package test
+
+	type T struct{}
+
+	func (T) B(b chan int) {
+		b <- 2
+	}
+
+	func A(t T, a chan int) {
+		t.B(a)
+	}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	assert.Len(t, reports, 2)
+}
+
+func TestModesChannel(t *testing.T) {
+	code := `
+	package %s
+
+	func A(a chan int) {
+		a <- 2
+	}
+
+	func b(b chan int) {
+		b <- 2
+	}
+	`
+
+	tt := map[string]struct {
+		Mode    ChanDirectionMode
+		Package string
+		Count   int
+	}{
+		"all":             {Mode: ChanDirectionAll, Package: "test", Count: 2},
+		"internal":        {Mode: ChanDirectionInternal, Package: "test", Count: 1},
+		"internal-main":   {Mode: ChanDirectionInternal, Package: "main", Count: 2},
+		"unexported":      {Mode: ChanDirectionUnexported, Package: "test", Count: 1},
+		"unexported-main": {Mode: ChanDirectionUnexported, Package: "main", Count: 1},
+	}
+
+	for name, tc := range tt {
+		fset := token.NewFileSet()
+		checker := NewChanDirectionChecker(fset)
+		checker.SetMode(tc.Mode)
+		checker.SetPackages(ast.PackagesFromCode(fset, fmt.Sprintf(code, tc.Package)))
+
+		// if
+		reports := checker.CodeChanges()
+
+		// then
+		assert.Len(t, reports, tc.Count, name)
+	}
+}
+
+func TestInterfaceMethodChannel(t *testing.T) {
+	code := `
+	package test
+
+	type Sender interface {
+		Send(ch chan int)
+	}
+
+	type T struct{}
+
+	func (*T) Send(ch chan int) {
+		ch <- 2
+	}
+
+	func (*T) send(ch chan int) {
+		ch <- 2
+	}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	assert.Len(t, reports, 1)
+}
+
+func TestEmbeddedInterfaceMethodChannel(t *testing.T) {
+	code := `
+	package test
+
+	type T struct{}
+
+	func (T) Send(ch chan int) {
+		ch <- 2
+	}
+
+	type U struct {
+		T
+	}
+
+	var _ interface{ Send(chan int) } = U{}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	assert.Len(t, reports, 0)
+}
+
+func TestFuncValueChannel(t *testing.T) {
+	code := `
+	package test
+
+	var handlers = []func(chan int){A}
+
+	func A(a chan int) {
+		a <- 2
+	}
+
+	func B(b chan int) {
+		A(b)
+	}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	assert.Len(t, reports, 0)
+}
+
+func TestFuncTypeSignatureChannel(t *testing.T) {
+	code := `
+	package test
+
+	type Worker func(ch chan int)
+
+	func A(a chan int) {
+		a <- 2
+	}
+
+	func B(b chan int, n int) {
+		b <- n
+	}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	assert.Len(t, reports, 1)
+}
+
+// applyChanges returns code with changes applied.
+func applyChanges(code string, changes []codechange.CodeChange) string {
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Offset > changes[j].Offset
+	})
+
+	for _, change := range changes {
+		code = code[:change.Offset] + string(change.Add) + code[change.Offset+change.Delete:]
+	}
+
+	return code
+}
+
+func TestGroupedParamsChannel(t *testing.T) {
+	tt := map[string]struct {
+		Before string
+		After  string
+	}{
+		"same-direction": {
+			Before: "package test\nfunc A(a, b chan int) { a <- 1; b <- 2 }\n",
+			After:  "package test\nfunc A(a, b chan<- int) { a <- 1; b <- 2 }\n",
+		},
+		"different-directions": {
+			Before: "package test\nfunc A(a, b chan int) { a <- 1; <-b }\n",
+			After:  "package test\nfunc A(a chan<- int, b <-chan int) { a <- 1; <-b }\n",
+		},
+		"one-bidirectional": {
+			Before: "package test\nfunc A(a, b, c chan []int) { <-a; b <- nil; <-b; <-c }\n",
+			After:  "package test\nfunc A(a <-chan []int, b chan []int, c <-chan []int) { <-a; b <- nil; <-b; <-c }\n",
+		},
+		"spacing-and-comments": {
+			Before: "package test\nfunc A(a   chan /* ints */  int, b  chan\tint) { a <- 1; <-b }\n",
+			After:  "package test\nfunc A(a   chan<- /* ints */  int, b  <-chan\tint) { a <- 1; <-b }\n",
+		},
+	}
+
+	for name, tc := range tt {
+		fset := token.NewFileSet()
+		checker := NewChanDirectionChecker(fset)
+		checker.SetPackages(ast.PackagesFromCode(fset, tc.Before))
+
+		// if
+		reports := checker.CodeChanges()
+
+		// then
+		assert.Equal(t, tc.After, applyChanges(tc.Before, reports), name)
+	}
+}
+
+func TestSelectWorkerChannel(t *testing.T) {
+	code := `
+	package test
+
+	func worker(jobs chan int, results chan int, quit chan struct{}) {
+		for {
+			select {
+			case j, ok := <-jobs:
+				if !ok {
+					return
+				}
+				results <- j
+			case (results) <- 0:
+			case <-quit:
+				return
+			}
+		}
+	}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	assert.Len(t, reports, 3)
+}
+
+func TestChannelUsages(t *testing.T) {
+	tt := map[string]struct {
+		Body  string
+		Count int
+	}{
+		"paren-send":        {Body: "(a) <- 1", Count: 1},
+		"paren-recv":        {Body: "<-(a)", Count: 1},
+		"len-cap":           {Body: "_ = len(a) + cap(a); a <- 1", Count: 1},
+		"len-only":          {Body: "_ = len(a)", Count: 0},
+		"nil-comparison":    {Body: "if a != nil { a <- 1 }", Count: 1},
+		"chan-comparison":   {Body: "var b chan int; _ = a == b; a <- 1", Count: 0},
+		"recv-conversion":   {Body: "var b <-chan int = (<-chan int)(a); <-b", Count: 1},
+		"local-alias":       {Body: "b := a; <-b; a <- 1", Count: 0},
+		"struct-field":      {Body: "s := struct{ c chan int }{}; s.c = a; a <- 1", Count: 0},
+		"composite-literal": {Body: "_ = []chan int{a}; a <- 1", Count: 0},
+		"sent-over-channel": {Body: "var out chan chan int; out <- a; <-a", Count: 0},
+		"address-of":        {Body: "_ = &a; a <- 1", Count: 0},
+		"returned":          {Body: "<-a; return a", Count: 0},
+		"recv-from-call":    {Body: "<-func() chan int { return nil }(); a <- 1", Count: 1},
+	}
+
+	for name, tc := range tt {
+		code := fmt.Sprintf("package test\nfunc A(a chan int) chan int {\n%s\nreturn nil\n}\n", tc.Body)
+
+		fset := token.NewFileSet()
+		checker := NewChanDirectionChecker(fset)
+		checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+		// if
+		reports := checker.CodeChanges()
+
+		// then
+		assert.Len(t, reports, tc.Count, name)
+	}
+}
+
+func TestResultChannel(t *testing.T) {
+	tt := map[string]struct {
+		Before string
+		After  string
+	}{
+		"generator": {
+			Before: "package test\nfunc gen() chan int { ch := make(chan int); go func() { ch <- 1; close(ch) }(); return ch }\nfunc A() { for v := range gen() { _ = v } }\n",
+			After:  "package test\nfunc gen() <-chan int { ch := make(chan int); go func() { ch <- 1; close(ch) }(); return ch }\nfunc A() { for v := range gen() { _ = v } }\n",
+		},
+		"local-variable": {
+			Before: "package test\nfunc gen() (chan int, error) { return nil, nil }\nfunc A() { ch, err := gen(); _ = err; consume(ch) }\nfunc consume(c chan int) { <-c }\n",
+			After:  "package test\nfunc gen() (<-chan int, error) { return nil, nil }\nfunc A() { ch, err := gen(); _ = err; consume(ch) }\nfunc consume(c <-chan int) { <-c }\n",
+		},
+		"sent-by-caller": {
+			Before: "package test\nfunc gen() chan int { return nil }\nfunc A() { ch := gen(); ch <- 1; <-ch }\n",
+			After:  "package test\nfunc gen() chan int { return nil }\nfunc A() { ch := gen(); ch <- 1; <-ch }\n",
+		},
+		"returned-again": {
+			Before: "package test\nfunc gen() chan int { return nil }\nfunc A() chan int { <-gen(); return gen() }\n",
+			After:  "package test\nfunc gen() chan int { return nil }\nfunc A() chan int { <-gen(); return gen() }\n",
+		},
+		"method": {
+			Before: "package test\ntype T struct{}\nfunc (T) gen() chan int { return nil }\nfunc A(t T) { t.gen() <- 1 }\n",
+			After:  "package test\ntype T struct{}\nfunc (T) gen() chan<- int { return nil }\nfunc A(t T) { t.gen() <- 1 }\n",
+		},
+		"exported": {
+			Before: "package test\nfunc Gen() chan int { return nil }\nfunc A() { <-Gen() }\n",
+			After:  "package test\nfunc Gen() chan int { return nil }\nfunc A() { <-Gen() }\n",
+		},
+	}
+
+	for name, tc := range tt {
+		fset := token.NewFileSet()
+		checker := NewChanDirectionChecker(fset)
+		checker.SetMode(ChanDirectionUnexported)
+		checker.SetPackages(ast.PackagesFromCode(fset, tc.Before))
+
+		// if
+		reports := checker.CodeChanges()
+
+		// then
+		assert.Equal(t, tc.After, applyChanges(tc.Before, reports), name)
+	}
+}
+
+func TestStructFieldChannel(t *testing.T) {
+	tt := map[string]struct {
+		Before string
+		After  string
+	}{
+		"send-only": {
+			Before: "package test\ntype T struct{ done chan struct{}; Out chan int }\nfunc New() *T { return &T{done: make(chan struct{})} }\nfunc (t *T) stop() { t.done <- struct{}{} }\n",
+			After:  "package test\ntype T struct{ done chan<- struct{}; Out chan int }\nfunc New() *T { return &T{done: make(chan struct{})} }\nfunc (t *T) stop() { t.done <- struct{}{} }\n",
+		},
+		"send-and-recv": {
+			Before: "package test\ntype T struct{ done chan struct{} }\nfunc (t *T) stop() { t.done <- struct{}{} }\nfunc (t *T) wait() { <-t.done }\n",
+			After:  "package test\ntype T struct{ done chan struct{} }\nfunc (t *T) stop() { t.done <- struct{}{} }\nfunc (t *T) wait() { <-t.done }\n",
+		},
+		"grouped": {
+			Before: "package test\ntype T struct{ in, out chan int }\nfunc (t *T) run() { t.out = make(chan int); t.out <- 1; t.in <- 1 }\n",
+			After:  "package test\ntype T struct{ in, out chan<- int }\nfunc (t *T) run() { t.out = make(chan int); t.out <- 1; t.in <- 1 }\n",
+		},
+		"grouped-disagree": {
+			Before: "package test\ntype T struct{ in, out chan int }\nfunc (t *T) run() { t.out <- <-t.in }\n",
+			After:  "package test\ntype T struct{ in, out chan int }\nfunc (t *T) run() { t.out <- <-t.in }\n",
+		},
+		"aliased": {
+			Before: "package test\ntype T struct{ c chan int }\nfunc (t *T) run() { c := t.c; c <- 1; other(t.c) }\nfunc other(c chan int) { c <- 1 }\n",
+			After:  "package test\ntype T struct{ c chan<- int }\nfunc (t *T) run() { c := t.c; c <- 1; other(t.c) }\nfunc other(c chan<- int) { c <- 1 }\n",
+		},
+		"stored": {
+			Before: "package test\ntype T struct{ c chan int }\nvar chans []chan int\nfunc (t *T) run() { t.c <- 1; chans = append(chans, t.c) }\n",
+			After:  "package test\ntype T struct{ c chan int }\nvar chans []chan int\nfunc (t *T) run() { t.c <- 1; chans = append(chans, t.c) }\n",
+		},
+	}
+
+	for name, tc := range tt {
+		fset := token.NewFileSet()
+		checker := NewChanDirectionChecker(fset)
+		checker.SetPackages(ast.PackagesFromCode(fset, tc.Before))
+
+		// if
+		reports := checker.CodeChanges()
+
+		// then
+		assert.Equal(t, tc.After, applyChanges(tc.Before, reports), name)
+	}
+}
+
+func TestGenericsChannel(t *testing.T) {
+	tt := map[string]struct {
+		Before string
+		After  string
+	}{
+		"generic-function": {
+			Before: "package test\nfunc send[T any](ch chan T, v T) { ch <- v }\nfunc A(ch chan int) { send(ch, 1); send[int](ch, 2) }\n",
+			After:  "package test\nfunc send[T any](ch chan<- T, v T) { ch <- v }\nfunc A(ch chan<- int) { send(ch, 1); send[int](ch, 2) }\n",
+		},
+		"generic-method": {
+			Before: "package test\ntype S[T any] struct{ c chan T }\nfunc (s *S[T]) send(ch chan T) { ch <- <-s.c }\nfunc A(s *S[int], ch chan int) { s.send(ch) }\n",
+			After:  "package test\ntype S[T any] struct{ c <-chan T }\nfunc (s *S[T]) send(ch chan<- T) { ch <- <-s.c }\nfunc A(s *S[int], ch chan<- int) { s.send(ch) }\n",
+		},
+		"named-type": {
+			Before: "package test\ntype Job struct{}\ntype Jobs chan Job\nfunc worker(jobs Jobs) { for j := range jobs { _ = j } }\n",
+			After:  "package test\ntype Job struct{}\ntype Jobs chan Job\nfunc worker(jobs <-chan Job) { for j := range jobs { _ = j } }\n",
+		},
+		"named-type-grouped": {
+			Before: "package test\ntype Jobs chan int\nfunc worker(in, out Jobs) { out <- <-in }\n",
+			After:  "package test\ntype Jobs chan int\nfunc worker(in <-chan int, out chan<- int) { out <- <-in }\n",
+		},
+		"named-type-method": {
+			Before: "package test\ntype Jobs chan int\nfunc (j Jobs) Len() int { return len(j) }\nfunc worker(jobs Jobs) { <-jobs; _ = jobs.Len() }\n",
+			After:  "package test\ntype Jobs chan int\nfunc (j Jobs) Len() int { return len(j) }\nfunc worker(jobs Jobs) { <-jobs; _ = jobs.Len() }\n",
+		},
+		"alias": {
+			Before: "package test\ntype Jobs = chan []string\nfunc worker(jobs Jobs) { jobs <- nil }\n",
+			After:  "package test\ntype Jobs = chan []string\nfunc worker(jobs chan<- []string) { jobs <- nil }\n",
+		},
+		"imported-element": {
+			Before: "package test\nimport t \"time\"\ntype Ticks chan t.Time\nfunc worker(ticks Ticks) { <-ticks }\n",
+			After:  "package test\nimport t \"time\"\ntype Ticks chan t.Time\nfunc worker(ticks <-chan t.Time) { <-ticks }\n",
+		},
+		"type-parameter-constraint": {
+			Before: "package test\nfunc send[C ~chan int](c C) { c <- 1 }\nfunc A(ch chan int) { send(ch) }\n",
+			After:  "package test\nfunc send[C ~chan int](c C) { c <- 1 }\nfunc A(ch chan int) { send(ch) }\n",
+		},
+	}
+
+	for name, tc := range tt {
+		fset := token.NewFileSet()
+		checker := NewChanDirectionChecker(fset)
+		checker.SetPackages(ast.PackagesFromCode(fset, tc.Before))
+
+		// if
+		reports := checker.CodeChanges()
+
+		// then
+		assert.Equal(t, tc.After, applyChanges(tc.Before, reports), name)
+	}
+}
+
+func TestReadOnlyFileChannel(t *testing.T) {
+	generated := `
+	package test
+
+	func send(ch chan int) {
+		ch <- 1
+	}
+
+	type worker struct {
+		jobs chan int
+	}
+	`
+
+	code := `
+	package test
+
+	func A(a chan int) {
+		send(a)
+	}
+
+	func B(w worker) {
+		w.jobs <- 1
+	}
+
+	func C(c chan int) {
+		c <- 1
+	}
+	`
+
+	fset := token.NewFileSet()
+	files := make(map[string]*goast.File)
+	for filename, src := range map[string]string{"generated.go": generated, "code.go": code} {
+		file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if !assert.NoError(t, err) {
+			return
+		}
+		files[filename] = file
+	}
+	pkg, _ := goast.NewPackage(fset, files, nil, nil)
+
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages([]*goast.Package{pkg})
+	checker.SetReadOnly(func(filename string) bool {
+		return filename == "generated.go"
+	})
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	// A must keep passing a bidirectional channel to send
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, "code.go", reports[0].Filename)
+		assert.Equal(t, 12, reports[0].Line)
+	}
+}
+
+func TestSeveralPackagesChannel(t *testing.T) {
+	first := `
+	package first
+
+	type Jobs chan int
+
+	func consume(jobs Jobs) {
+		for range jobs {
+		}
+	}
+	`
+
+	second := `
+	package second
+
+	func produce(ch chan int) {
+		ch <- 1
+	}
+	`
+
+	for _, concurrency := range []int{1, 4} {
+		fset := token.NewFileSet()
+		checker := NewChanDirectionChecker(fset)
+		checker.SetConcurrency(concurrency)
+		checker.SetPackages(ast.PackagesFromCode(fset, first, second, first, second))
+
+		// if
+		reports := checker.CodeChanges()
+
+		// then
+		// Each package is analyzed with its own type information, e.g. to write the element type of Jobs
+		if !assert.Len(t, reports, 4) {
+			continue
+		}
+		assert.Equal(t, "<-chan int", string(reports[0].Add))
+		assert.Equal(t, "<-", string(reports[1].Add))
+		assert.Equal(t, "<-chan int", string(reports[2].Add))
+		assert.Equal(t, "<-", string(reports[3].Add))
+		for i := 1; i < len(reports); i++ {
+			assert.True(t, reports[i-1].Filename < reports[i].Filename, "changes are sorted")
+		}
+	}
+}
+
+func TestTypeErrorsChannel(t *testing.T) {
+	code := `
+	package test
+
+	import "example.com/missing"
+
+	var _ missing.Sink = T{}
+
+	type T struct{}
+
+	func (T) Put(ch chan int) {
+		ch <- 1
+	}
+
+	func produce(ch chan int) {
+		ch <- 1
+	}
+	`
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(ast.PackagesFromCode(fset, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	// Without the types of the import, T may implement missing.Sink: nothing is narrowed
+	assert.Len(t, reports, 0)
+}
+
+func TestLoadedTypesChannel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chandir")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	for filename, content := range map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"a/a.go": "package a\n\ntype Sink interface{ Put(chan int) }\n",
+		"b/b.go": "package b\n\nimport \"example.com/m/a\"\n\ntype T struct{}\n\nfunc (T) Put(ch chan int) { ch <- 1 }\n\n" +
+			"func produce(ch chan int) { ch <- 1 }\n\nvar _ a.Sink = T{}\n",
+	} {
+		path := filepath.Join(dir, filename)
+		if !assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755)) ||
+			!assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644)) {
+			return
+		}
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := ast.Load(fset, dir, ast.LoadConfig{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	checker := NewChanDirectionChecker(fset)
+	checker.SetPackages(pkgs.List)
+	checker.SetTypes(pkgs.TypesOf)
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	// T implements the interface of the sibling package a, only produce is narrowed
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, filepath.Join(dir, "b/b.go"), reports[0].Filename)
+		assert.Equal(t, 9, reports[0].Line)
+	}
+}
+
+func TestContextChannel(t *testing.T) {
+	code := `
+	package test
+
+	func produce(ch chan int) {
+		ch <- 1
+	}
+	`
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	fset := token.NewFileSet()
+	checker := NewChanDirectionChecker(fset)
+	checker.SetContext(ctx)
+	checker.SetPackages(ast.PackagesFromCode(fset, code, code))
+
+	// if
+	reports := checker.CodeChanges()
+
+	// then
+	assert.Nil(t, reports)
+}
@@ -1,7 +1,9 @@
 package checker
 
 import (
+	"context"
 	"go/ast"
+	"go/types"
 
 	"github.com/segflow/contribuehub/pkg/codechange"
 )
@@ -9,5 +11,13 @@ import (
 // Checker in the interface to be implemented by all checkers.
 type Checker interface {
 	SetPackages([]*ast.Package)
+	// SetReadOnly sets the function reporting the files which must not be changed.
+	// They are still analysed, e.g. to know how their functions use channels.
+	SetReadOnly(func(filename string) bool)
+	// SetTypes sets the function returning the type information of a package, loaded with its dependencies,
+	// and the error making it partial. Packages without type information are type checked by the checker.
+	SetTypes(func(pkg *ast.Package) (*types.Package, *types.Info, error))
+	// SetContext sets the context interrupting CodeChanges once done, which then returns no change.
+	SetContext(ctx context.Context)
 	CodeChanges() []codechange.CodeChange
 }
@@ -0,0 +1,104 @@
+package checker
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+)
+
+// Options are the options of the checkers. Each checker uses the ones relevant to it.
+type Options struct {
+	// ChanDirectionMode sets which functions the channel direction checker may change
+	ChanDirectionMode ChanDirectionMode
+
+	// Concurrency is the number of packages analyzed concurrently, GOMAXPROCS when 0
+	Concurrency int
+}
+
+// Info describes a checker.
+type Info struct {
+	// Name is the name used to select the checker, and the source of its changes
+	Name        string
+	Description string
+	// Rationale explains to the maintainers why the changes are worth it
+	Rationale string
+	// Example is a Go snippet showing a change, before and after
+	Example string
+
+	// New returns a new checker using fset and configured by opts
+	New func(fset *token.FileSet, opts Options) Checker
+}
+
+var registry = map[string]Info{
+	chanDirectionSource: {
+		Name:        chanDirectionSource,
+		Description: "Narrows bidirectional channels only used to send or receive to send only or receive only channels.",
+		Rationale: "A channel typed after its use documents how a function uses it, and the compiler then rejects any misuse, " +
+			"like receiving from a channel the function should only send to.",
+		Example: `// Before
+func produce(ch chan int) {
+	ch <- 42
+}
+
+// After
+func produce(ch chan<- int) {
+	ch <- 42
+}`,
+		New: func(fset *token.FileSet, opts Options) Checker {
+			c := NewChanDirectionChecker(fset)
+			c.SetMode(opts.ChanDirectionMode)
+			if opts.Concurrency > 0 {
+				c.SetConcurrency(opts.Concurrency)
+			}
+			return c
+		},
+	},
+}
+
+// All returns all the checkers, sorted by name.
+func All() []Info {
+	var infos []Info
+	for _, info := range registry {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos
+}
+
+// Select returns the checkers named names, all the checkers when names is empty.
+func Select(names []string) ([]Info, error) {
+	if len(names) == 0 {
+		return All(), nil
+	}
+
+	var infos []Info
+	seen := make(map[string]bool)
+	for _, name := range names {
+		info, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown checker %q", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			infos = append(infos, info)
+		}
+	}
+
+	return infos, nil
+}
+
+// ParseChanDirectionMode parses the name of a ChanDirectionMode: "all", "internal" or "unexported".
+func ParseChanDirectionMode(name string) (ChanDirectionMode, error) {
+	switch name {
+	case "all":
+		return ChanDirectionAll, nil
+	case "internal":
+		return ChanDirectionInternal, nil
+	case "unexported":
+		return ChanDirectionUnexported, nil
+	}
+	return 0, fmt.Errorf("unknown channel direction mode %q, expecting all, internal or unexported", name)
+}
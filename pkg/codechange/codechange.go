@@ -1,11 +1,9 @@
 package codechange
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
-	"io"
-	"os"
+	"io/ioutil"
 	"sort"
 )
 
@@ -20,60 +18,108 @@ type CodeChange struct {
 
 	// Number of characters to delete from the current position
 	Delete int
+
+	// Source is the name of the checker which produced the change
+	Source string
+
+	// Message explains the change
+	Message string
 }
 
-// FileApplyChanges applies the changes to file filename. It does not edit the file, the expected file content is returned.
-func FileApplyChanges(filename string, changes []CodeChange) ([]byte, error) {
-	sort.SliceStable(changes, func(i, j int) bool {
-		return changes[i].Offset < changes[j].Offset
-	})
+// end returns the offset following the last deleted character.
+func (c CodeChange) end() int {
+	return c.Offset + c.Delete
+}
 
-	f, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+func (c CodeChange) equal(other CodeChange) bool {
+	return c.Offset == other.Offset && c.Delete == other.Delete && bytes.Equal(c.Add, other.Add)
+}
+
+func (c CodeChange) String() string {
+	source := c.Source
+	if source == "" {
+		source = "unknown"
 	}
-	defer f.Close()
 
-	reader := bufio.NewReader(f)
-	buf := bytes.NewBuffer(nil)
-	var lastOffset int
+	switch {
+	case c.Delete == 0:
+		return fmt.Sprintf("%s: insert %q at offset %d", source, c.Add, c.Offset)
+	case len(c.Add) == 0:
+		return fmt.Sprintf("%s: delete [%d, %d)", source, c.Offset, c.end())
+	}
+	return fmt.Sprintf("%s: replace [%d, %d) by %q", source, c.Offset, c.end(), c.Add)
+}
 
-	for _, change := range changes {
-		readCount := change.Offset - lastOffset
-		b := make([]byte, readCount)
-		count, err := io.ReadFull(reader, b)
-		if count != readCount {
-			return nil, err
-		}
+// ConflictError is returned when two changes of the same file overlap.
+type ConflictError struct {
+	Filename string
+	A, B     CodeChange
+}
 
-		buf.Write(b)
-		buf.Write(change.Add)
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflicting changes in %q: %s and %s", e.Filename, e.A, e.B)
+}
 
-		lastOffset = readCount
+// conflict reports whether changes a and b, with a.Offset <= b.Offset, cannot be both applied.
+//
+// Changes touching the same range are ambiguous, unless they are identical: e.g. two insertions at the same offset,
+// or an insertion at the start of a deletion. Adjacent changes, like a deletion followed by an insertion where it ends,
+// don't conflict.
+func conflict(a, b CodeChange) bool {
+	if a.Offset == b.Offset {
+		return true
 	}
+	return b.Offset < a.end()
+}
 
-	// Copy the result
-	io.Copy(buf, reader)
+// Apply applies the changes to content and returns the new content. content is not modified.
+//
+// Offsets are relative to the original content. Identical changes, e.g. reported by two checkers,
+// are applied once. Overlapping changes are rejected with a *ConflictError.
+func Apply(content []byte, changes []CodeChange) ([]byte, error) {
+	sorted := make([]CodeChange, len(changes))
+	copy(sorted, changes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
 
-	return buf.Bytes(), nil
-}
+	var merged []CodeChange
+	for _, change := range sorted {
+		if change.Offset < 0 || change.Delete < 0 || change.end() > len(content) {
+			return nil, fmt.Errorf("change out of range of %q (%d bytes): %s", change.Filename, len(content), change)
+		}
 
-// FileApplyChangesInplace is like FileApplyChanges but edits the file
-func FileApplyChangesInplace(filename string, changes []CodeChange) error {
-	content, err := FileApplyChanges(filename, changes)
-	if err != nil {
-		return fmt.Errorf("error applying changes to file %q: %v", filename, err)
+		if len(merged) != 0 {
+			last := merged[len(merged)-1]
+			if last.equal(change) {
+				continue
+			}
+			if conflict(last, change) {
+				return nil, &ConflictError{Filename: change.Filename, A: last, B: change}
+			}
+		}
+
+		merged = append(merged, change)
 	}
 
-	f, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("error overwriting the file %q: %v", filename, err)
+	buf := bytes.NewBuffer(make([]byte, 0, len(content)))
+	var lastOffset int
+	for _, change := range merged {
+		buf.Write(content[lastOffset:change.Offset])
+		buf.Write(change.Add)
+		lastOffset = change.end()
 	}
+	buf.Write(content[lastOffset:])
+
+	return buf.Bytes(), nil
+}
 
-	_, err = f.Write(content)
+// FileApplyChanges applies the changes to file filename. It does not edit the file, the expected file content is returned.
+func FileApplyChanges(filename string, changes []CodeChange) ([]byte, error) {
+	content, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return fmt.Errorf("error writing result to file %q: %v", filename, err)
+		return nil, err
 	}
 
-	return nil
+	return Apply(content, changes)
 }
@@ -1,7 +1,10 @@
 package codechange
 
 import (
+	"bytes"
+	"errors"
 	"io/ioutil"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -44,3 +47,142 @@ func TestChangeFile(t *testing.T) {
 		assert.Equal(t, content, out)
 	}
 }
+
+func TestApply(t *testing.T) {
+	tt := map[string]struct {
+		Content  string
+		Changes  []CodeChange
+		Expected string
+		Conflict bool
+		Fail     bool
+	}{
+		"insert": {
+			Content:  "func A(ch chan int)",
+			Changes:  []CodeChange{{Offset: 14, Add: []byte("<-")}},
+			Expected: "func A(ch chan<- int)",
+		},
+		"delete": {
+			Content:  "func A(ch chan<- int)",
+			Changes:  []CodeChange{{Offset: 14, Delete: 2}},
+			Expected: "func A(ch chan int)",
+		},
+		"replace": {
+			Content:  "func A(ch Jobs)",
+			Changes:  []CodeChange{{Offset: 10, Delete: 4, Add: []byte("<-chan Job")}},
+			Expected: "func A(ch <-chan Job)",
+		},
+		"three-changes": {
+			Content: "a chan int, b chan int, c chan int",
+			Changes: []CodeChange{
+				{Offset: 30, Add: []byte("<-")},
+				{Offset: 2, Add: []byte("<-")},
+				{Offset: 14, Add: []byte("<-")},
+			},
+			Expected: "a <-chan int, b <-chan int, c chan<- int",
+		},
+		"adjacent": {
+			Content:  "abcdef",
+			Changes:  []CodeChange{{Offset: 1, Delete: 2, Add: []byte("X")}, {Offset: 3, Add: []byte("Y")}},
+			Expected: "aXYdef",
+		},
+		"identical-merged": {
+			Content:  "chan int",
+			Changes:  []CodeChange{{Offset: 0, Add: []byte("<-"), Source: "a"}, {Offset: 0, Add: []byte("<-"), Source: "b"}},
+			Expected: "<-chan int",
+		},
+		"same-offset-insertions": {
+			Content:  "chan int",
+			Changes:  []CodeChange{{Offset: 4, Add: []byte("<-"), Source: "a"}, {Offset: 4, Add: []byte(" "), Source: "b"}},
+			Conflict: true,
+		},
+		"insertion-in-deletion": {
+			Content:  "abcdef",
+			Changes:  []CodeChange{{Offset: 1, Delete: 3, Source: "a"}, {Offset: 2, Add: []byte("X"), Source: "b"}},
+			Conflict: true,
+		},
+		"overlapping-deletions": {
+			Content:  "abcdef",
+			Changes:  []CodeChange{{Offset: 3, Delete: 2, Source: "a"}, {Offset: 1, Delete: 3, Source: "b"}},
+			Conflict: true,
+		},
+		"out-of-range": {
+			Content: "abc",
+			Changes: []CodeChange{{Offset: 2, Delete: 2}},
+			Fail:    true,
+		},
+	}
+
+	for name, tc := range tt {
+		out, err := Apply([]byte(tc.Content), tc.Changes)
+		if tc.Conflict {
+			var conflict *ConflictError
+			if assert.True(t, errors.As(err, &conflict), name) {
+				assert.Contains(t, err.Error(), "a:", name)
+				assert.Contains(t, err.Error(), "b:", name)
+			}
+			continue
+		}
+		if tc.Fail {
+			assert.Error(t, err, name)
+			continue
+		}
+
+		assert.NoError(t, err, name)
+		assert.Equal(t, tc.Expected, string(out), name)
+	}
+}
+
+func FuzzApply(f *testing.F) {
+	f.Add([]byte("func A(ch chan int) {}"), []byte{14, 0, 2, 3, 1, 0})
+	f.Add([]byte("abcdef"), []byte{1, 2, 1, 1, 0, 1, 3, 0, 1})
+	f.Add([]byte(""), []byte{0, 0, 1})
+
+	f.Fuzz(func(t *testing.T, content []byte, ops []byte) {
+		// Each change is encoded by 3 bytes: offset, delete and add length
+		var changes []CodeChange
+		for i := 0; i+2 < len(ops); i += 3 {
+			changes = append(changes, CodeChange{
+				Offset: int(ops[i]),
+				Delete: int(ops[i+1] % 8),
+				Add:    bytes.Repeat([]byte{'+'}, int(ops[i+2]%4)),
+			})
+		}
+
+		out, err := Apply(content, changes)
+		if err != nil {
+			return
+		}
+
+		// Non conflicting changes give the same result whatever their order
+		reversed := make([]CodeChange, len(changes))
+		for i, change := range changes {
+			reversed[len(changes)-1-i] = change
+		}
+		out2, err := Apply(content, reversed)
+		if assert.NoError(t, err) {
+			assert.Equal(t, out, out2)
+		}
+
+		// Applying the changes one by one, from the end of the content, gives the same result
+		var unique []CodeChange
+		for _, change := range changes {
+			duplicate := false
+			for _, u := range unique {
+				duplicate = duplicate || u.equal(change)
+			}
+			if !duplicate {
+				unique = append(unique, change)
+			}
+		}
+		sort.Slice(unique, func(i, j int) bool {
+			return unique[i].Offset > unique[j].Offset
+		})
+
+		expected := append([]byte(nil), content...)
+		for _, change := range unique {
+			tail := append([]byte(nil), expected[change.end():]...)
+			expected = append(append(expected[:change.Offset], change.Add...), tail...)
+		}
+		assert.Equal(t, expected, out)
+	})
+}
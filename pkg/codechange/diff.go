@@ -0,0 +1,305 @@
+package codechange
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultContext is the number of unchanged lines shown around each change, like `diff -u`.
+const DefaultContext = 3
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// lineOp is a step of the edit script transforming the old lines into the new lines.
+type lineOp struct {
+	kind opKind
+	line string
+
+	// oldLine and newLine are the 0-based indexes of the line before the op.
+	oldLine, newLine int
+}
+
+// Diff returns the unified diff between before and after, using oldName and newName as the file names.
+// context is the number of unchanged lines shown around each change. nil is returned when contents are identical.
+func Diff(oldName, newName string, before, after []byte, context int) []byte {
+	if bytes.Equal(before, after) {
+		return nil
+	}
+	if context < 0 {
+		context = 0
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", oldName, newName)
+
+	ops := diffLines(splitLines(before), splitLines(after))
+	for _, hunk := range hunks(ops, context) {
+		writeHunk(buf, hunk)
+	}
+
+	return buf.Bytes()
+}
+
+// FileDiff returns the unified diff of the changes to file filename, as FileApplyChangesInplace would apply them.
+func FileDiff(filename string, changes []CodeChange, context int) ([]byte, error) {
+	before, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := NewContent(filename, before, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return Diff(filename, filename, before, after, context), nil
+}
+
+// Patch returns the changes of every file as a multi-file patch, which can be applied with `git apply` from directory root.
+// Files are sorted by name so the patch is reproducible. Changes are validated as in FilesApplyChangesInplace.
+func Patch(root string, changes map[string][]CodeChange, context int) ([]byte, error) {
+	var filenames []string
+	for filename := range changes {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	for _, filename := range filenames {
+		before, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		after, err := NewContent(filename, before, changes[filename])
+		if err != nil {
+			return nil, err
+		}
+
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil {
+			return nil, fmt.Errorf("file %q is not in %q: %v", filename, root, err)
+		}
+		rel = filepath.ToSlash(rel)
+
+		diff := Diff("a/"+rel, "b/"+rel, before, after, context)
+		if diff == nil {
+			continue
+		}
+
+		fmt.Fprintf(buf, "diff --git a/%s b/%s\n", rel, rel)
+		buf.Write(diff)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// splitLines splits content in lines, keeping the line feeds.
+func splitLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script from a to b, using the Myers algorithm.
+// Common prefix and suffix are trimmed first: changes made by checkers are small compared to files.
+func diffLines(a, b []string) []lineOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []lineOp
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, lineOp{kind: opEqual, line: a[i]})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for i := len(a) - suffix; i < len(a); i++ {
+		ops = append(ops, lineOp{kind: opEqual, line: a[i]})
+	}
+
+	var oldLine, newLine int
+	for i := range ops {
+		ops[i].oldLine, ops[i].newLine = oldLine, newLine
+		switch ops[i].kind {
+		case opEqual:
+			oldLine++
+			newLine++
+		case opDelete:
+			oldLine++
+		case opInsert:
+			newLine++
+		}
+	}
+
+	return ops
+}
+
+func myers(a, b []string) []lineOp {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	// v[k+max] is the furthest x reached on diagonal k, trace keeps v before each round
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+max] < v[k+1+max]) {
+				x = v[k+1+max]
+			} else {
+				x = v[k-1+max] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+max] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, max)
+			}
+		}
+	}
+
+	return nil
+}
+
+func backtrack(a, b []string, trace [][]int, offset int) []lineOp {
+	var ops []lineOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+offset]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, lineOp{kind: opEqual, line: a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, lineOp{kind: opInsert, line: b[y-1]})
+			} else {
+				ops = append(ops, lineOp{kind: opDelete, line: a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// hunks groups the changed ops with their context lines. Changes separated by
+// no more than 2*context unchanged lines are in the same hunk.
+func hunks(ops []lineOp, context int) [][]lineOp {
+	var result [][]lineOp
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		last := i
+		for j := i; j < len(ops) && j-last <= 2*context+1; j++ {
+			if ops[j].kind != opEqual {
+				last = j
+			}
+		}
+
+		end := last + 1 + context
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		result = append(result, ops[start:end])
+		i = end
+	}
+
+	return result
+}
+
+func writeHunk(buf *bytes.Buffer, hunk []lineOp) {
+	var oldCount, newCount int
+	for _, op := range hunk {
+		if op.kind != opInsert {
+			oldCount++
+		}
+		if op.kind != opDelete {
+			newCount++
+		}
+	}
+
+	// An empty range starts at the line preceding it
+	oldStart, newStart := hunk[0].oldLine, hunk[0].newLine
+	if oldCount != 0 {
+		oldStart++
+	}
+	if newCount != 0 {
+		newStart++
+	}
+	fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+
+	for _, op := range hunk {
+		switch op.kind {
+		case opEqual:
+			buf.WriteByte(' ')
+		case opDelete:
+			buf.WriteByte('-')
+		case opInsert:
+			buf.WriteByte('+')
+		}
+		buf.WriteString(op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package codechange
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	tt := map[string]struct {
+		Before   string
+		After    string
+		Context  int
+		Expected string
+	}{
+		"identical": {
+			Before:   "a\nb\n",
+			After:    "a\nb\n",
+			Context:  3,
+			Expected: "",
+		},
+		"one-line": {
+			Before:  "a\nb\nc\n",
+			After:   "a\nB\nc\n",
+			Context: 3,
+			Expected: `--- old
++++ new
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+		},
+		"no-context": {
+			Before:  "a\nb\nc\n",
+			After:   "a\nb\nX\nc\n",
+			Context: 0,
+			Expected: `--- old
++++ new
+@@ -2,0 +3,1 @@
++X
+`,
+		},
+		"two-hunks": {
+			Before:  "1\n2\n3\n4\n5\n6\n7\n8\n",
+			After:   "one\n2\n3\n4\n5\n6\n7\neight\n",
+			Context: 1,
+			Expected: `--- old
++++ new
+@@ -1,2 +1,2 @@
+-1
++one
+ 2
+@@ -7,2 +7,2 @@
+ 7
+-8
++eight
+`,
+		},
+		"merged-hunks": {
+			Before:  "1\n2\n3\n4\n",
+			After:   "one\n2\n3\nfour\n",
+			Context: 1,
+			Expected: `--- old
++++ new
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+-4
++four
+`,
+		},
+		"no-newline": {
+			Before:  "a\nb",
+			After:   "a\nc",
+			Context: 3,
+			Expected: `--- old
++++ new
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++c
+\ No newline at end of file
+`,
+		},
+		"new-content": {
+			Before:  "",
+			After:   "a\n",
+			Context: 3,
+			Expected: `--- old
++++ new
+@@ -0,0 +1,1 @@
++a
+`,
+		},
+	}
+
+	for name, tc := range tt {
+		diff := Diff("old", "new", []byte(tc.Before), []byte(tc.After), tc.Context)
+		assert.Equal(t, tc.Expected, string(diff), name)
+	}
+}
+
+func TestPatchGitApply(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir, err := ioutil.TempDir("", "codechange")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	before, err := ioutil.ReadFile("testdata/sample1.go.before")
+	if !assert.NoError(t, err) {
+		return
+	}
+	after, err := ioutil.ReadFile("testdata/sample1.go.after")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	filename := filepath.Join(dir, "pkg", "sample1.go")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+	assert.NoError(t, ioutil.WriteFile(filename, before, 0644))
+
+	changes := map[string][]CodeChange{
+		filename: {
+			{Filename: filename, Offset: 47, Add: []byte("<-")},
+			{Filename: filename, Offset: 78, Add: []byte("<-")},
+		},
+	}
+	patch, err := Patch(dir, changes, DefaultContext)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, strings.HasPrefix(string(patch), "diff --git a/pkg/sample1.go b/pkg/sample1.go\n"))
+
+	cmd := exec.Command("git", "apply", "-")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(string(patch))
+	out, err := cmd.CombinedOutput()
+	if !assert.NoError(t, err, string(out)) {
+		return
+	}
+
+	patched, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, string(after), string(patched))
+}
@@ -0,0 +1,161 @@
+package codechange
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileEdit is the new content of a file, computed before any file is written.
+type fileEdit struct {
+	filename string
+	mode     os.FileMode
+	before   []byte
+	after    []byte
+
+	// tmp is the temporary file holding after until it is renamed to filename
+	tmp string
+}
+
+// NewContent applies the changes to the content of Go file filename and checks the result still parses.
+//
+// The result is formatted with gofmt, e.g. to realign struct fields, unless the original content was not
+// formatted: formatting it would add unrelated changes.
+func NewContent(filename string, before []byte, changes []CodeChange) ([]byte, error) {
+	after, err := Apply(before, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(filename, ".go") {
+		return after, nil
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), filename, after, parser.ParseComments); err != nil {
+		return nil, fmt.Errorf("changes to %q produce invalid code: %v", filename, err)
+	}
+
+	formatted, err := format.Source(after)
+	if err != nil {
+		return nil, fmt.Errorf("error formatting %q: %v", filename, err)
+	}
+
+	if original, err := format.Source(before); err == nil && bytes.Equal(original, before) {
+		return formatted, nil
+	}
+	return after, nil
+}
+
+// FilesApplyChangesInplace applies the changes of every file, as a single transaction.
+//
+// The new content of all files is computed and validated first: Go files must still parse. Each file
+// is then written to a temporary file and renamed over the original, keeping its permissions. If any
+// step fails, the files already renamed are restored and no file is left changed.
+func FilesApplyChangesInplace(changes map[string][]CodeChange) error {
+	var filenames []string
+	for filename := range changes {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	var edits []*fileEdit
+	for _, filename := range filenames {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+
+		before, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		after, err := NewContent(filename, before, changes[filename])
+		if err != nil {
+			return fmt.Errorf("error applying changes to file %q: %v", filename, err)
+		}
+
+		edits = append(edits, &fileEdit{
+			filename: filename,
+			mode:     info.Mode().Perm(),
+			before:   before,
+			after:    after,
+		})
+	}
+
+	defer func() {
+		for _, edit := range edits {
+			if edit.tmp != "" {
+				os.Remove(edit.tmp)
+			}
+		}
+	}()
+
+	for _, edit := range edits {
+		tmp, err := writeTemp(edit.filename, edit.after, edit.mode)
+		if err != nil {
+			return fmt.Errorf("error writing result of file %q: %v", edit.filename, err)
+		}
+		edit.tmp = tmp
+	}
+
+	for i, edit := range edits {
+		if err := os.Rename(edit.tmp, edit.filename); err != nil {
+			rollback(edits[:i])
+			return fmt.Errorf("error overwriting the file %q: %v", edit.filename, err)
+		}
+		edit.tmp = ""
+	}
+
+	return nil
+}
+
+// FileApplyChangesInplace is like FileApplyChanges but edits the file, see FilesApplyChangesInplace.
+func FileApplyChangesInplace(filename string, changes []CodeChange) error {
+	return FilesApplyChangesInplace(map[string][]CodeChange{filename: changes})
+}
+
+// writeTemp writes content to a new temporary file in the directory of filename, and returns its name.
+func writeTemp(filename string, content []byte, mode os.FileMode) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// rollback restores the original content of the edited files.
+func rollback(edits []*fileEdit) {
+	for _, edit := range edits {
+		tmp, err := writeTemp(edit.filename, edit.before, edit.mode)
+		if err != nil {
+			continue
+		}
+		if err := os.Rename(tmp, edit.filename); err != nil {
+			os.Remove(tmp)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package codechange
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilesApplyChangesInplace(t *testing.T) {
+	tt := map[string]struct {
+		Files    map[string]string
+		Changes  map[string][]CodeChange
+		Expected map[string]string
+		Fail     bool
+	}{
+		"two-files": {
+			Files: map[string]string{
+				"a.go": "package p\n\nfunc a(ch chan int) { ch <- 1 }\n",
+				"b.go": "package p\n\nfunc b(ch chan int) { <-ch }\n",
+			},
+			Changes: map[string][]CodeChange{
+				"a.go": {{Offset: 25, Add: []byte("<-")}},
+				"b.go": {{Offset: 21, Add: []byte("<-")}},
+			},
+			Expected: map[string]string{
+				"a.go": "package p\n\nfunc a(ch chan<- int) { ch <- 1 }\n",
+				"b.go": "package p\n\nfunc b(ch <-chan int) { <-ch }\n",
+			},
+		},
+		"gofmt": {
+			Files: map[string]string{
+				"a.go": "package p\n\ntype t struct {\n\tch chan int // c\n\tn  int      // n\n}\n",
+			},
+			Changes: map[string][]CodeChange{
+				"a.go": {{Offset: 35, Add: []byte("<-")}},
+			},
+			Expected: map[string]string{
+				"a.go": "package p\n\ntype t struct {\n\tch chan<- int // c\n\tn  int        // n\n}\n",
+			},
+		},
+		"not-formatted": {
+			Files: map[string]string{
+				"a.go": "package p\nfunc a(ch chan int)  { ch <- 1 }\n",
+			},
+			Changes: map[string][]CodeChange{
+				"a.go": {{Offset: 24, Add: []byte("<-")}},
+			},
+			Expected: map[string]string{
+				"a.go": "package p\nfunc a(ch chan<- int)  { ch <- 1 }\n",
+			},
+		},
+		"invalid-rollback": {
+			Files: map[string]string{
+				"a.go": "package p\n\nfunc a(ch chan int) { ch <- 1 }\n",
+				"b.go": "package p\n\nfunc b(ch chan int) { <-ch }\n",
+			},
+			Changes: map[string][]CodeChange{
+				"a.go": {{Offset: 25, Add: []byte("<-")}},
+				"b.go": {{Offset: 21, Add: []byte("(")}},
+			},
+			Fail: true,
+		},
+	}
+
+	for name, tc := range tt {
+		dir, err := ioutil.TempDir("", "codechange")
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+
+		changes := make(map[string][]CodeChange)
+		for filename, content := range tc.Files {
+			path := filepath.Join(dir, filename)
+			assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600), name)
+			changes[path] = tc.Changes[filename]
+		}
+
+		err = FilesApplyChangesInplace(changes)
+		expected := tc.Expected
+		if tc.Fail {
+			assert.Error(t, err, name)
+			expected = tc.Files
+		} else {
+			assert.NoError(t, err, name)
+		}
+
+		for filename, content := range expected {
+			path := filepath.Join(dir, filename)
+			out, err := ioutil.ReadFile(path)
+			assert.NoError(t, err, name)
+			assert.Equal(t, content, string(out), name)
+
+			info, err := os.Stat(path)
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), name)
+			}
+		}
+
+		// No temporary file is left
+		entries, err := ioutil.ReadDir(dir)
+		assert.NoError(t, err, name)
+		assert.Len(t, entries, len(tc.Files), name)
+
+		os.RemoveAll(dir)
+	}
+}
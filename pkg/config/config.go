@@ -0,0 +1,499 @@
+// Package config loads the configuration of the contributehub pipeline from a YAML or TOML file,
+// overridden by CONTRIBUTEHUB_* environment variables.
+//
+// Environment variables are named after the keys, upper cased, with dots replaced by underscores:
+// CONTRIBUTEHUB_CLONE_DIR sets clone.dir. Lists are comma separated, e.g.
+// CONTRIBUTEHUB_FILTER_IGNORE="kubernetes/kubernetes,golang/*".
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/segflow/contribuehub/pkg/checker"
+	"github.com/segflow/contribuehub/pkg/log"
+	"github.com/segflow/contribuehub/pkg/publisher"
+	"github.com/segflow/contribuehub/pkg/verify"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// EnvPrefix is the prefix of the environment variables overriding the configuration
+	EnvPrefix = "CONTRIBUTEHUB"
+
+	// configName is the name, without extension, of the configuration file looked up in the
+	// current directory when none is given
+	configName = "contributehub"
+)
+
+// Config is the configuration of the pipeline.
+type Config struct {
+	GitHub      GitHub      `mapstructure:"github"`
+	Discoverers Discoverers `mapstructure:"discoverers"`
+	Filter      Filter      `mapstructure:"filter"`
+	Clone       Clone       `mapstructure:"clone"`
+	Checkers    Checkers    `mapstructure:"checkers"`
+	Verify      Verify      `mapstructure:"verify"`
+	Publisher   Publisher   `mapstructure:"publisher"`
+	Concurrency Concurrency `mapstructure:"concurrency"`
+	Shutdown    Shutdown    `mapstructure:"shutdown"`
+	Queue       Queue       `mapstructure:"queue"`
+	Metrics     Metrics     `mapstructure:"metrics"`
+	Dashboard   Dashboard   `mapstructure:"dashboard"`
+	Log         Log         `mapstructure:"log"`
+}
+
+// GitHub configures the GitHub API client.
+type GitHub struct {
+	// Token is the API token, also read from GITHUB_TOKEN
+	Token string `mapstructure:"token"`
+}
+
+// Discoverers configures how new repositories are found.
+type Discoverers struct {
+	Events EventsDiscoverer `mapstructure:"events"`
+}
+
+// EventsDiscoverer configures the discovery of repositories from the GitHub public events.
+type EventsDiscoverer struct {
+	// Period is the time waited between two event listings
+	Period time.Duration `mapstructure:"period"`
+	// PerPage is the number of events of each page, at most 100
+	PerPage int `mapstructure:"per_page"`
+	// Workers is the number of repositories fetched concurrently
+	Workers int `mapstructure:"workers"`
+}
+
+// Filter configures which discovered repositories are processed.
+type Filter struct {
+	// Languages are the main languages of the processed repositories, all of them when empty
+	Languages []string `mapstructure:"languages"`
+	// IncludeForks enables processing forks
+	IncludeForks bool `mapstructure:"include_forks"`
+	// MinStars is the minimum number of stars of processed repositories
+	MinStars int `mapstructure:"min_stars"`
+	// Ignore are OWNER/NAME patterns, as matched by path.Match, of repositories never processed
+	Ignore []string `mapstructure:"ignore"`
+}
+
+// Clone configures the clones of the repositories.
+type Clone struct {
+	// Dir is the directory of the clones, kept between runs as a cache
+	Dir string `mapstructure:"dir"`
+	// Depth is the number of commits fetched, the whole history when 0
+	Depth int `mapstructure:"depth"`
+}
+
+// Checkers configures the analysis of the repositories.
+type Checkers struct {
+	// Enabled are the names of the checkers run, all of them when empty
+	Enabled []string `mapstructure:"enabled"`
+	// Exclude are the patterns of the files which must not be changed
+	Exclude []string `mapstructure:"exclude"`
+	// Tags are the additional build tags
+	Tags []string `mapstructure:"tags"`
+	// Tests enables checking test files
+	Tests bool `mapstructure:"tests"`
+
+	ChanDir ChanDir `mapstructure:"chandir"`
+}
+
+// ChanDir configures the channel direction checker.
+type ChanDir struct {
+	// Mode is all, internal or unexported. When empty, local directories use all, and GitHub repositories internal.
+	Mode string `mapstructure:"mode"`
+}
+
+// Verify configures the verification of the changes.
+type Verify struct {
+	// Tests enables running the tests
+	Tests bool `mapstructure:"tests"`
+	// Timeout of each go command
+	Timeout time.Duration `mapstructure:"timeout"`
+	// ModCache is the module cache used to build the repositories offline
+	ModCache string `mapstructure:"mod_cache"`
+	// BuildCache is the build cache shared by the verifications, a temporary one for each verification when empty
+	BuildCache string `mapstructure:"build_cache"`
+	// Sandbox runs the go commands as an unprivileged user, without network access unless GoProxy needs it.
+	// Only supported on Linux
+	Sandbox bool `mapstructure:"sandbox"`
+	// GoProxy is the GOPROXY resolving the modules missing from ModCache, e.g. a file:// URL to a local proxy.
+	// The repositories are built offline when empty
+	GoProxy string `mapstructure:"goproxy"`
+	// Parallelism limits the packages built and tested in parallel, by the go tool default when 0
+	Parallelism int `mapstructure:"parallelism"`
+	// MemoryLimit is the soft memory limit of the go commands, e.g. "2GiB", unlimited when empty
+	MemoryLimit string `mapstructure:"memory_limit"`
+}
+
+// Publisher configures where the changes go.
+type Publisher struct {
+	// PatchDir is the directory of the patches of the changes, one per repository
+	PatchDir string `mapstructure:"patch_dir"`
+	// Policy is how the changes of each checker are published
+	Policy Policy `mapstructure:"policy"`
+	// ClosedBackoff is the time during which no pull request is opened on a repository for the checkers
+	// of a pull request closed without being merged
+	ClosedBackoff time.Duration `mapstructure:"closed_backoff"`
+	// CheckPeriod is the time between two checks of the open pull requests
+	CheckPeriod time.Duration `mapstructure:"check_period"`
+	// OnConflict is what is done with the open pull requests conflicting with upstream changes: rebase or close
+	OnConflict string `mapstructure:"on_conflict"`
+	// Template is the template of the titles and descriptions of the pull requests
+	Template Template `mapstructure:"template"`
+}
+
+// Template configures the titles and descriptions of the pull requests, Go text/templates executed with
+// a publisher.Data.
+type Template struct {
+	// Title is the template of the titles, the built-in one when empty
+	Title string `mapstructure:"title"`
+	// BodyFile is the file of the template of the descriptions, the built-in one when empty
+	BodyFile string `mapstructure:"body_file"`
+}
+
+// Templates returns the parsed templates.
+func (t Template) Templates() (*publisher.Templates, error) {
+	return publisher.NewTemplates(t.Title, t.BodyFile)
+}
+
+// Policy configures how the changes of the checkers are published: dry-run, review or auto.
+type Policy struct {
+	// Default is the mode of the checkers missing from Checkers
+	Default string `mapstructure:"default"`
+	// Checkers are the modes of the checkers, by name
+	Checkers map[string]string `mapstructure:"checkers"`
+}
+
+// Mode returns the publish mode of the checker name. The policy must be valid.
+func (p Policy) Mode(name string) publisher.Mode {
+	if mode, ok := p.Checkers[name]; ok {
+		return publisher.Mode(mode)
+	}
+	return publisher.Mode(p.Default)
+}
+
+// Concurrency configures the number of repositories handled concurrently by each stage.
+type Concurrency struct {
+	// Cloners is the number of repositories cloned concurrently
+	Cloners int `mapstructure:"cloners"`
+	// Processors is the number of repositories analysed and verified concurrently
+	Processors int `mapstructure:"processors"`
+}
+
+// Shutdown configures how the pipeline stops.
+type Shutdown struct {
+	// Timeout is the time given to the repositories in flight to be processed once stopping,
+	// they are interrupted and their changes discarded after that
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Queue configures the durable queue of the repositories between the stages.
+type Queue struct {
+	// Dir is the directory of the queue, kept between runs to resume where the pipeline stopped
+	Dir string `mapstructure:"dir"`
+	// MaxAttempts is the number of failures after which a repository is parked
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// Backoff is the delay before retrying a repository after its first failure, doubled on each failure
+	Backoff time.Duration `mapstructure:"backoff"`
+	// MaxBackoff is the maximum delay before retrying a repository
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+}
+
+// Metrics configures the HTTP server of the metrics, health and readiness of the run command.
+type Metrics struct {
+	// Listen is the address of the server, e.g. ":8080", disabled when empty
+	Listen string `mapstructure:"listen"`
+}
+
+// Dashboard configures the web dashboard of the run command, showing the queue and reviewing the changes.
+type Dashboard struct {
+	// Listen is the address of the dashboard, e.g. "localhost:8081", disabled when empty
+	Listen string `mapstructure:"listen"`
+}
+
+// Log configures the logs.
+type Log struct {
+	// Format is text or json
+	Format string `mapstructure:"format"`
+	// Level is the minimum level of the messages: trace, debug, info, warning or error
+	Level string `mapstructure:"level"`
+}
+
+// AnalysisConcurrency is the number of packages each processor analyses concurrently,
+// sharing the CPUs between the processors.
+func (c Concurrency) AnalysisConcurrency() int {
+	n := runtime.GOMAXPROCS(0) / c.Processors
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// defaults are the values of the keys missing from the file and the environment.
+// Every key must have a default, environment variables only override known keys.
+var defaults = map[string]interface{}{
+	"github.token": "",
+
+	"discoverers.events.period":   30 * time.Second,
+	"discoverers.events.per_page": 100,
+	"discoverers.events.workers":  8,
+
+	"filter.languages":     []string{"Go"},
+	"filter.include_forks": false,
+	"filter.min_stars":     0,
+	"filter.ignore":        []string{"kubernetes/kubernetes"},
+
+	"clone.dir":   "/tmp/contributehub",
+	"clone.depth": 1,
+
+	"checkers.enabled":      []string{},
+	"checkers.exclude":      []string{},
+	"checkers.tags":         []string{},
+	"checkers.tests":        false,
+	"checkers.chandir.mode": "",
+
+	"verify.tests":        true,
+	"verify.timeout":      10 * time.Minute,
+	"verify.mod_cache":    "/tmp/contributehub-modcache",
+	"verify.build_cache":  "/tmp/contributehub-gocache",
+	"verify.sandbox":      runtime.GOOS == "linux",
+	"verify.goproxy":      "",
+	"verify.parallelism":  2,
+	"verify.memory_limit": "2GiB",
+
+	"publisher.patch_dir":          "/tmp/contributehub-patches",
+	"publisher.policy.default":     string(publisher.DryRun),
+	"publisher.policy.checkers":    map[string]string{},
+	"publisher.closed_backoff":     30 * 24 * time.Hour,
+	"publisher.check_period":       time.Hour,
+	"publisher.on_conflict":        string(publisher.RebaseConflicting),
+	"publisher.template.title":     "",
+	"publisher.template.body_file": "",
+
+	"concurrency.cloners":    4,
+	"concurrency.processors": 4,
+
+	"shutdown.timeout": 2 * time.Minute,
+
+	"queue.dir":          "/tmp/contributehub-queue",
+	"queue.max_attempts": 5,
+	"queue.backoff":      time.Minute,
+	"queue.max_backoff":  time.Hour,
+
+	"metrics.listen": ":8080",
+
+	"dashboard.listen": "localhost:8081",
+
+	"log.format": "text",
+	"log.level":  "info",
+}
+
+// Load returns the configuration read from filename, overridden by the environment.
+// When filename is empty, contributehub.yaml, .yml or .toml is read from the current directory if it exists,
+// otherwise the defaults are used. Unknown keys are errors. The configuration isn't validated.
+func Load(filename string) (*Config, error) {
+	v := viper.New()
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	if err := v.BindEnv("github.token", EnvPrefix+"_GITHUB_TOKEN", "GITHUB_TOKEN"); err != nil {
+		return nil, err
+	}
+
+	if filename != "" {
+		v.SetConfigFile(filename)
+	} else {
+		v.SetConfigName(configName)
+		v.AddConfigPath(".")
+	}
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if filename != "" || !errors.As(err, &notFound) {
+			return nil, fmt.Errorf("error reading configuration: %v", err)
+		}
+	}
+
+	var cfg Config
+	if err := v.UnmarshalExact(&cfg); err != nil {
+		name := v.ConfigFileUsed()
+		if name == "" {
+			name = "environment"
+		}
+		return nil, fmt.Errorf("invalid configuration %s: %v", name, err)
+	}
+
+	return &cfg, nil
+}
+
+// ValidationErrors are the invalid values of a configuration.
+type ValidationErrors []error
+
+func (errs ValidationErrors) Error() string {
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Validate returns the ValidationErrors of cfg, nil when it's valid.
+func (cfg *Config) Validate() error {
+	var errs ValidationErrors
+	fail := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	events := cfg.Discoverers.Events
+	if events.Period <= 0 {
+		fail("discoverers.events.period", "must be positive, got %s", events.Period)
+	}
+	if events.PerPage < 1 || events.PerPage > 100 {
+		fail("discoverers.events.per_page", "must be between 1 and 100, got %d", events.PerPage)
+	}
+	if events.Workers < 1 {
+		fail("discoverers.events.workers", "must be at least 1, got %d", events.Workers)
+	}
+
+	if cfg.Filter.MinStars < 0 {
+		fail("filter.min_stars", "must not be negative, got %d", cfg.Filter.MinStars)
+	}
+	for _, pattern := range cfg.Filter.Ignore {
+		if _, err := path.Match(pattern, ""); err != nil || strings.Count(pattern, "/") != 1 {
+			fail("filter.ignore", "invalid pattern %q, expecting OWNER/NAME", pattern)
+		}
+	}
+
+	if cfg.Clone.Dir == "" {
+		fail("clone.dir", "must be set")
+	}
+	if cfg.Clone.Depth < 0 {
+		fail("clone.depth", "must not be negative, got %d", cfg.Clone.Depth)
+	}
+
+	if _, err := checker.Select(cfg.Checkers.Enabled); err != nil {
+		fail("checkers.enabled", "%v", err)
+	}
+	for _, pattern := range cfg.Checkers.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			fail("checkers.exclude", "invalid pattern %q", pattern)
+		}
+	}
+	if cfg.Checkers.ChanDir.Mode != "" {
+		if _, err := checker.ParseChanDirectionMode(cfg.Checkers.ChanDir.Mode); err != nil {
+			fail("checkers.chandir.mode", "%v", err)
+		}
+	}
+
+	if cfg.Verify.Timeout <= 0 {
+		fail("verify.timeout", "must be positive, got %s", cfg.Verify.Timeout)
+	}
+	if cfg.Verify.Parallelism < 0 {
+		fail("verify.parallelism", "must not be negative, got %d", cfg.Verify.Parallelism)
+	}
+	if err := verify.ValidateGoProxy(cfg.Verify.GoProxy); err != nil {
+		fail("verify.goproxy", "%v", err)
+	}
+	if cfg.Verify.Sandbox && runtime.GOOS != "linux" {
+		fail("verify.sandbox", "only supported on Linux, not %s", runtime.GOOS)
+	}
+
+	if cfg.Publisher.PatchDir == "" {
+		fail("publisher.patch_dir", "must be set")
+	}
+	review := false
+	if mode, err := publisher.ParseMode(cfg.Publisher.Policy.Default); err != nil {
+		fail("publisher.policy.default", "%v", err)
+	} else {
+		review = mode == publisher.Review
+	}
+	var names []string
+	for name := range cfg.Publisher.Policy.Checkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := checker.Select([]string{name}); err != nil {
+			fail("publisher.policy.checkers", "%v", err)
+		}
+		if mode, err := publisher.ParseMode(cfg.Publisher.Policy.Checkers[name]); err != nil {
+			fail("publisher.policy.checkers."+name, "%v", err)
+		} else if mode == publisher.Review {
+			review = true
+		}
+	}
+	if cfg.Publisher.ClosedBackoff < 0 {
+		fail("publisher.closed_backoff", "must not be negative, got %s", cfg.Publisher.ClosedBackoff)
+	}
+	if cfg.Publisher.CheckPeriod <= 0 {
+		fail("publisher.check_period", "must be positive, got %s", cfg.Publisher.CheckPeriod)
+	}
+	if _, err := publisher.ParseConflictAction(cfg.Publisher.OnConflict); err != nil {
+		fail("publisher.on_conflict", "%v", err)
+	}
+	if _, err := cfg.Publisher.Template.Templates(); err != nil {
+		fail("publisher.template", "%v", err)
+	}
+
+	if cfg.Concurrency.Cloners < 1 {
+		fail("concurrency.cloners", "must be at least 1, got %d", cfg.Concurrency.Cloners)
+	}
+	if cfg.Concurrency.Processors < 1 {
+		fail("concurrency.processors", "must be at least 1, got %d", cfg.Concurrency.Processors)
+	}
+
+	if cfg.Shutdown.Timeout <= 0 {
+		fail("shutdown.timeout", "must be positive, got %s", cfg.Shutdown.Timeout)
+	}
+
+	if cfg.Queue.Dir == "" {
+		fail("queue.dir", "must be set")
+	}
+	if cfg.Queue.MaxAttempts < 1 {
+		fail("queue.max_attempts", "must be at least 1, got %d", cfg.Queue.MaxAttempts)
+	}
+	if cfg.Queue.Backoff <= 0 {
+		fail("queue.backoff", "must be positive, got %s", cfg.Queue.Backoff)
+	}
+	if cfg.Queue.MaxBackoff < cfg.Queue.Backoff {
+		fail("queue.max_backoff", "must be at least queue.backoff, got %s", cfg.Queue.MaxBackoff)
+	}
+
+	if cfg.Metrics.Listen != "" {
+		if _, _, err := net.SplitHostPort(cfg.Metrics.Listen); err != nil {
+			fail("metrics.listen", "invalid address %q: %v", cfg.Metrics.Listen, err)
+		}
+	}
+
+	if cfg.Dashboard.Listen != "" {
+		if _, _, err := net.SplitHostPort(cfg.Dashboard.Listen); err != nil {
+			fail("dashboard.listen", "invalid address %q: %v", cfg.Dashboard.Listen, err)
+		}
+	}
+	if review && cfg.Dashboard.Listen == "" {
+		fail("publisher.policy", "the review mode requires dashboard.listen, to approve the changes")
+	}
+
+	if _, err := log.NewFormatter(cfg.Log.Format); err != nil {
+		fail("log.format", "%v", err)
+	}
+	if _, err := logrus.ParseLevel(cfg.Log.Level); err != nil {
+		fail("log.level", "%v", err)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segflow/contribuehub/pkg/publisher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	filename := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(filename, []byte(content), 0644))
+	return filename
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "token")
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.NoError(t, cfg.Validate())
+
+	assert.Equal(t, "token", cfg.GitHub.Token)
+	assert.Equal(t, 30*time.Second, cfg.Discoverers.Events.Period)
+	assert.Equal(t, []string{"Go"}, cfg.Filter.Languages)
+	assert.Equal(t, []string{"kubernetes/kubernetes"}, cfg.Filter.Ignore)
+	assert.Equal(t, "/tmp/contributehub", cfg.Clone.Dir)
+	assert.Equal(t, 1, cfg.Clone.Depth)
+	assert.Equal(t, 4, cfg.Concurrency.Processors)
+	assert.Equal(t, publisher.DryRun, cfg.Publisher.Policy.Mode("chandir"))
+	assert.Equal(t, 30*24*time.Hour, cfg.Publisher.ClosedBackoff)
+	assert.Equal(t, "rebase", cfg.Publisher.OnConflict)
+	assert.Equal(t, "localhost:8081", cfg.Dashboard.Listen)
+	assert.Equal(t, "text", cfg.Log.Format)
+}
+
+func TestLoadFile(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+discoverers:
+  events:
+    period: 1m
+    workers: 2
+filter:
+  ignore: [golang/*]
+  min_stars: 10
+checkers:
+  enabled: [chandir]
+  chandir:
+    mode: unexported
+publisher:
+  policy:
+    default: auto
+    checkers:
+      chandir: review
+verify:
+  goproxy: file:///srv/goproxy,off
+concurrency:
+  processors: 1
+`,
+		"config.toml": `
+[discoverers.events]
+period = "1m"
+workers = 2
+
+[filter]
+ignore = ["golang/*"]
+min_stars = 10
+
+[checkers]
+enabled = ["chandir"]
+
+[checkers.chandir]
+mode = "unexported"
+
+[publisher.policy]
+default = "auto"
+
+[publisher.policy.checkers]
+chandir = "review"
+
+[verify]
+goproxy = "file:///srv/goproxy,off"
+
+[concurrency]
+processors = 1
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, name, content))
+			require.NoError(t, err)
+			assert.NoError(t, cfg.Validate())
+
+			assert.Equal(t, time.Minute, cfg.Discoverers.Events.Period)
+			assert.Equal(t, 2, cfg.Discoverers.Events.Workers)
+			assert.Equal(t, 100, cfg.Discoverers.Events.PerPage)
+			assert.Equal(t, []string{"golang/*"}, cfg.Filter.Ignore)
+			assert.Equal(t, 10, cfg.Filter.MinStars)
+			assert.Equal(t, []string{"chandir"}, cfg.Checkers.Enabled)
+			assert.Equal(t, "unexported", cfg.Checkers.ChanDir.Mode)
+			assert.Equal(t, "file:///srv/goproxy,off", cfg.Verify.GoProxy)
+			assert.Equal(t, 1, cfg.Concurrency.Processors)
+			assert.Equal(t, 4, cfg.Concurrency.Cloners)
+			assert.Equal(t, publisher.Review, cfg.Publisher.Policy.Mode("chandir"))
+			assert.Equal(t, publisher.Auto, cfg.Publisher.Policy.Mode("other"))
+		})
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	filename := writeConfig(t, "config.yaml", "clone:\n  dir: /file\n")
+	t.Setenv("CONTRIBUTEHUB_CLONE_DIR", "/env")
+	t.Setenv("CONTRIBUTEHUB_FILTER_IGNORE", "a/b,c/*")
+	t.Setenv("CONTRIBUTEHUB_VERIFY_TIMEOUT", "5m")
+	t.Setenv("CONTRIBUTEHUB_GITHUB_TOKEN", "env-token")
+
+	cfg, err := Load(filename)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/env", cfg.Clone.Dir)
+	assert.Equal(t, []string{"a/b", "c/*"}, cfg.Filter.Ignore)
+	assert.Equal(t, 5*time.Minute, cfg.Verify.Timeout)
+	assert.Equal(t, "env-token", cfg.GitHub.Token)
+}
+
+func TestLoadErrors(t *testing.T) {
+	tt := map[string]string{
+		"unknown-key":  "clone:\n  directory: /tmp\n",
+		"invalid-type": "concurrency:\n  cloners: many\n",
+		"invalid-yaml": "clone: [\n",
+	}
+
+	for name, content := range tt {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, "config.yaml", content))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	content := `
+discoverers:
+  events:
+    per_page: 300
+filter:
+  ignore: [kubernetes]
+clone:
+  dir: ""
+checkers:
+  enabled: [unknown]
+  chandir:
+    mode: exported
+concurrency:
+  cloners: 0
+verify:
+  goproxy: proxy.golang.org
+publisher:
+  policy:
+    default: review
+    checkers:
+      chandir: yolo
+      unknown: auto
+  on_conflict: merge
+  template:
+    title: "{{.Repo"
+dashboard:
+  listen: ""
+log:
+  format: xml
+  level: verbose
+`
+	cfg, err := Load(writeConfig(t, "config.yaml", content))
+	require.NoError(t, err)
+
+	err = cfg.Validate()
+	require.IsType(t, ValidationErrors{}, err)
+
+	var msgs []string
+	for _, err := range err.(ValidationErrors) {
+		msgs = append(msgs, err.Error())
+	}
+	assert.Equal(t, []string{
+		"discoverers.events.per_page: must be between 1 and 100, got 300",
+		`filter.ignore: invalid pattern "kubernetes", expecting OWNER/NAME`,
+		"clone.dir: must be set",
+		`checkers.enabled: unknown checker "unknown"`,
+		`checkers.chandir.mode: unknown channel direction mode "exported", expecting all, internal or unexported`,
+		`verify.goproxy: invalid proxy "proxy.golang.org", expecting off, direct or an http, https or file URL`,
+		`publisher.policy.checkers.chandir: unknown publish mode "yolo", expecting dry-run, review or auto`,
+		`publisher.policy.checkers: unknown checker "unknown"`,
+		`publisher.on_conflict: unknown conflict action "merge", expecting rebase or close`,
+		`publisher.template: invalid title template: template: title:1: unclosed action`,
+		"concurrency.cloners: must be at least 1, got 0",
+		"publisher.policy: the review mode requires dashboard.listen, to approve the changes",
+		`log.format: unknown log format "xml", expecting text or json`,
+		`log.level: not a valid logrus Level: "verbose"`,
+	}, msgs)
+}
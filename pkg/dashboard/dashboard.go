@@ -0,0 +1,303 @@
+// Package dashboard is the web dashboard of the pipeline: the repositories in each state of the queue,
+// their changes and verification, and the review of the changes waiting for approval.
+package dashboard
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/segflow/contribuehub/pkg/log"
+	"github.com/segflow/contribuehub/pkg/metrics"
+	"github.com/segflow/contribuehub/pkg/queue"
+	"github.com/segflow/contribuehub/pkg/stats"
+)
+
+// recentItems is the number of repositories listed on the index, most recently updated first
+const recentItems = 50
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		return t.Local().Format("2006-01-02 15:04:05")
+	},
+	"percent": func(f float64) string {
+		return fmt.Sprintf("%.0f%%", 100*f)
+	},
+	// group is the data of the acceptance template
+	"group": func(name string, acceptance []*stats.Acceptance) interface{} {
+		return struct {
+			Name  string
+			Stats []*stats.Acceptance
+		}{name, acceptance}
+	},
+}).ParseFS(templateFS, "templates/*.html"))
+
+type dashboard struct {
+	queue *queue.Queue
+}
+
+// Handler serves the dashboard of q:
+//   - / lists the pending repositories and the recently updated ones, or those in the state of the state parameter,
+//   - /repos/OWNER/NAME shows a repository, its patch and verification,
+//   - POST /repos/OWNER/NAME/approve and /reject approve or reject its pending changes,
+//   - POST /repos/OWNER/NAME/retry retries it when parked,
+//   - /stats shows the acceptance of the pull requests, and the comments of the maintainers.
+//
+// The same is served as JSON under /api, for the review and queue commands: /api/repos lists the repositories
+// in the state of the state parameter, /api/repos/OWNER/NAME returns a repository, and POST
+// /api/repos/OWNER/NAME/approve, /reject and /retry reply 204 No Content once done. /api/stats returns the acceptance, and /api/comments the comments.
+func Handler(q *queue.Queue) http.Handler {
+	d := &dashboard{queue: q}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", d.index)
+	mux.HandleFunc("GET /repos/{owner}/{name}", d.repo)
+	mux.HandleFunc("POST /repos/{owner}/{name}/approve", d.approve)
+	mux.HandleFunc("POST /repos/{owner}/{name}/reject", d.reject)
+	mux.HandleFunc("POST /repos/{owner}/{name}/retry", d.retry)
+	mux.HandleFunc("GET /stats", d.stats)
+
+	mux.HandleFunc("GET /api/repos", d.apiRepos)
+	mux.HandleFunc("GET /api/repos/{owner}/{name}", d.apiRepo)
+	mux.HandleFunc("POST /api/repos/{owner}/{name}/approve", d.apiApprove)
+	mux.HandleFunc("POST /api/repos/{owner}/{name}/reject", d.apiReject)
+	mux.HandleFunc("POST /api/repos/{owner}/{name}/retry", d.apiRetry)
+	mux.HandleFunc("GET /api/stats", d.apiStats)
+	mux.HandleFunc("GET /api/comments", d.apiComments)
+
+	return sameOrigin(mux)
+}
+
+// stateCount is the number of repositories in a state.
+type stateCount struct {
+	State queue.State
+	Count int
+}
+
+type indexPage struct {
+	States  []stateCount
+	Pending []*queue.Item
+
+	// State is the state of the listed items, the most recently updated items are listed when empty
+	State queue.State
+	Items []*queue.Item
+}
+
+func (d *dashboard) index(w http.ResponseWriter, r *http.Request) {
+	page := &indexPage{State: queue.State(r.URL.Query().Get("state"))}
+
+	counts := make(map[queue.State]int)
+	items := d.queue.Items()
+	for i := range items {
+		item := &items[i]
+		counts[item.State]++
+		if item.State == queue.Pending {
+			page.Pending = append(page.Pending, item)
+		}
+		if page.State == "" || item.State == page.State {
+			page.Items = append(page.Items, item)
+		}
+	}
+	for _, state := range queue.States {
+		page.States = append(page.States, stateCount{State: state, Count: counts[state]})
+	}
+
+	sort.SliceStable(page.Items, func(i, j int) bool {
+		return page.Items[i].UpdatedAt.After(page.Items[j].UpdatedAt)
+	})
+	if page.State == "" && len(page.Items) > recentItems {
+		page.Items = page.Items[:recentItems]
+	}
+
+	render(w, r, "index.html", page)
+}
+
+func (d *dashboard) repo(w http.ResponseWriter, r *http.Request) {
+	item, ok := d.queue.Get(repoName(r))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	render(w, r, "repo.html", item)
+}
+
+func (d *dashboard) approve(w http.ResponseWriter, r *http.Request) {
+	if d.review(w, r, queue.Approved) {
+		redirectToRepo(w, r, repoName(r))
+	}
+}
+
+func (d *dashboard) reject(w http.ResponseWriter, r *http.Request) {
+	if d.review(w, r, queue.Rejected) {
+		redirectToRepo(w, r, repoName(r))
+	}
+}
+
+func (d *dashboard) retry(w http.ResponseWriter, r *http.Request) {
+	if d.retryRepo(w, r) {
+		redirectToRepo(w, r, repoName(r))
+	}
+}
+
+type statsPage struct {
+	*stats.Stats
+	Comments []stats.Comment
+}
+
+func (d *dashboard) stats(w http.ResponseWriter, r *http.Request) {
+	items := d.queue.Items()
+	page := &statsPage{Stats: stats.Compute(items), Comments: stats.Comments(items)}
+	// Most recent first
+	sort.SliceStable(page.Comments, func(i, j int) bool {
+		return page.Comments[i].CreatedAt.After(page.Comments[j].CreatedAt)
+	})
+
+	render(w, r, "stats.html", page)
+}
+
+func (d *dashboard) apiRepos(w http.ResponseWriter, r *http.Request) {
+	state := queue.State(r.URL.Query().Get("state"))
+	items := []queue.Item{}
+	for _, item := range d.queue.Items() {
+		if state == "" || item.State == state {
+			items = append(items, item)
+		}
+	}
+
+	writeJSON(w, r, items)
+}
+
+func (d *dashboard) apiRepo(w http.ResponseWriter, r *http.Request) {
+	item, ok := d.queue.Get(repoName(r))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, r, item)
+}
+
+func (d *dashboard) apiStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, stats.Compute(d.queue.Items()))
+}
+
+func (d *dashboard) apiComments(w http.ResponseWriter, r *http.Request) {
+	comments := stats.Comments(d.queue.Items())
+	if comments == nil {
+		comments = []stats.Comment{}
+	}
+	writeJSON(w, r, comments)
+}
+
+func (d *dashboard) apiApprove(w http.ResponseWriter, r *http.Request) {
+	if d.review(w, r, queue.Approved) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (d *dashboard) apiReject(w http.ResponseWriter, r *http.Request) {
+	if d.review(w, r, queue.Rejected) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (d *dashboard) apiRetry(w http.ResponseWriter, r *http.Request) {
+	if d.retryRepo(w, r) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// review approves or rejects, depending on state, the pending changes of the repository of the request.
+// It returns false, after replying the error, when the repository isn't pending.
+func (d *dashboard) review(w http.ResponseWriter, r *http.Request, state queue.State) bool {
+	name := repoName(r)
+	logger := log.FromContext(r.Context()).WithField(log.FieldRepo, name)
+
+	var err error
+	if state == queue.Approved {
+		err = d.queue.Approve(name)
+	} else {
+		reason := r.PostFormValue("reason")
+		if reason == "" {
+			reason = "rejected by a reviewer"
+		}
+		if err = d.queue.Reject(name, reason); err == nil {
+			logger = logger.WithField("reason", reason)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return false
+	}
+
+	metrics.Repositories.WithLabelValues(string(state)).Inc()
+	logger.Infof("Changes %s", state)
+	return true
+}
+
+// retryRepo moves the parked repository of the request back to the state it failed in.
+// It returns false, after replying the error, when the repository isn't parked.
+func (d *dashboard) retryRepo(w http.ResponseWriter, r *http.Request) bool {
+	name := repoName(r)
+	if err := d.queue.Retry(name); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return false
+	}
+
+	log.FromContext(r.Context()).WithField(log.FieldRepo, name).Info("Retried")
+	return true
+}
+
+// repoName returns the OWNER/NAME of the repository of the request.
+func repoName(r *http.Request) string {
+	return r.PathValue("owner") + "/" + r.PathValue("name")
+}
+
+func redirectToRepo(w http.ResponseWriter, r *http.Request, name string) {
+	http.Redirect(w, r, "/repos/"+name, http.StatusSeeOther)
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.FromContext(r.Context()).Warnf("Error writing %s: %s", r.URL.Path, err)
+	}
+}
+
+// render writes the template name, executed with data.
+func render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		log.FromContext(r.Context()).Warnf("Error rendering %s: %s", name, err)
+	}
+}
+
+// sameOrigin rejects the requests changing the queue sent by other sites, e.g. a form of a malicious page
+// approving changes through the browser of a reviewer.
+func sameOrigin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if origin := r.Header.Get("Origin"); origin != "" {
+				u, err := url.Parse(origin)
+				if err != nil || u.Host != r.Host {
+					http.Error(w, "cross-origin request", http.StatusForbidden)
+					return
+				}
+			} else if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+				http.Error(w, "cross-origin request", http.StatusForbidden)
+				return
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
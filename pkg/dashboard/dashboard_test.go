@@ -0,0 +1,236 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/segflow/contribuehub/pkg/publisher"
+	"github.com/segflow/contribuehub/pkg/queue"
+	"github.com/segflow/contribuehub/pkg/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testQueue returns a queue with the pending repository owner/a, and the failed one owner/b.
+func testQueue(t *testing.T) *queue.Queue {
+	q, err := queue.Open(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close() })
+
+	for i, name := range []string{"a", "b"} {
+		_, err := q.Add(&github.Repository{
+			ID:      github.Int64(int64(i + 1)),
+			Owner:   &github.User{Login: github.String("owner")},
+			Name:    github.String(name),
+			HTMLURL: github.String("https://github.com/owner/" + name),
+		})
+		require.NoError(t, err)
+	}
+
+	a, _ := q.Get("owner/a")
+	a.FileCount = 1
+	a.Patch = []byte("--- a/main.go\n+++ b/main.go\n-func send(ch chan int) {\n+func send(ch chan<- int) {\n")
+	a.Outcome = "passed"
+	a.Modes = map[string]string{"chandir": "review"}
+	require.NoError(t, q.Advance(a, queue.Pending))
+
+	b, _ := q.Get("owner/b")
+	require.NoError(t, q.Park(b, "clone failed"))
+
+	return q
+}
+
+// noRedirect is a client returning the redirections instead of following them.
+var noRedirect = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func get(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func post(t *testing.T, url string, form url.Values, origin string) (int, string) {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+
+	resp, err := noRedirect.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	if resp.StatusCode == http.StatusSeeOther {
+		return resp.StatusCode, resp.Header.Get("Location")
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestIndex(t *testing.T) {
+	server := httptest.NewServer(Handler(testQueue(t)))
+	defer server.Close()
+
+	code, body := get(t, server.URL+"/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `<a href="/?state=pending">pending</a>`)
+	assert.Contains(t, body, `<a href="/repos/owner/a">owner/a</a>`)
+	assert.Contains(t, body, "clone failed")
+
+	code, body = get(t, server.URL+"/?state=failed")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "Repositories failed")
+	assert.Equal(t, 1, strings.Count(body, "/repos/owner/a"), "pending repository listed once")
+
+	code, _ = get(t, server.URL+"/unknown")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestRepo(t *testing.T) {
+	server := httptest.NewServer(Handler(testQueue(t)))
+	defer server.Close()
+
+	code, body := get(t, server.URL+"/repos/owner/a")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `<a href="https://github.com/owner/a">owner/a</a>`)
+	assert.Contains(t, body, "&#43;func send(ch chan&lt;- int) {")
+	assert.Contains(t, body, `action="/repos/owner/a/approve"`)
+	assert.Contains(t, body, "chandir (review)")
+
+	code, body = get(t, server.URL+"/repos/owner/b")
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, body, "approve")
+
+	code, _ = get(t, server.URL+"/repos/owner/unknown")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestReview(t *testing.T) {
+	q := testQueue(t)
+	server := httptest.NewServer(Handler(q))
+	defer server.Close()
+
+	code, body := post(t, server.URL+"/repos/owner/a/approve", nil, "https://example.com")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "cross-origin request\n", body)
+
+	code, location := post(t, server.URL+"/repos/owner/a/approve", nil, server.URL)
+	assert.Equal(t, http.StatusSeeOther, code)
+	assert.Equal(t, "/repos/owner/a", location)
+	a, _ := q.Get("owner/a")
+	assert.Equal(t, queue.Approved, a.State)
+
+	code, body = post(t, server.URL+"/repos/owner/a/reject", url.Values{"reason": {"too late"}}, "")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "repository \"owner/a\" is not pending, it is approved\n", body)
+}
+
+func TestReject(t *testing.T) {
+	q := testQueue(t)
+	server := httptest.NewServer(Handler(q))
+	defer server.Close()
+
+	code, _ := post(t, server.URL+"/repos/owner/a/reject", url.Values{"reason": {"not worth it"}}, "")
+	assert.Equal(t, http.StatusSeeOther, code)
+
+	a, _ := q.Get("owner/a")
+	assert.Equal(t, queue.Rejected, a.State)
+	assert.Equal(t, "not worth it", a.Rejection)
+
+	_, body := get(t, server.URL+"/repos/owner/a")
+	assert.Contains(t, body, "not worth it")
+}
+
+func TestAPI(t *testing.T) {
+	q := testQueue(t)
+	server := httptest.NewServer(Handler(q))
+	defer server.Close()
+
+	code, body := get(t, server.URL+"/api/repos?state=pending")
+	assert.Equal(t, http.StatusOK, code)
+	var items []queue.Item
+	require.NoError(t, json.Unmarshal([]byte(body), &items))
+	require.Len(t, items, 1)
+	assert.Equal(t, "owner/a", items[0].Name())
+	assert.Equal(t, "review", items[0].Modes["chandir"])
+
+	code, body = get(t, server.URL+"/api/repos?state=published")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "[]\n", body)
+
+	code, body = get(t, server.URL+"/api/repos/owner/b")
+	assert.Equal(t, http.StatusOK, code)
+	var item queue.Item
+	require.NoError(t, json.Unmarshal([]byte(body), &item))
+	assert.Equal(t, queue.Failed, item.State)
+
+	code, _ = post(t, server.URL+"/api/repos/owner/a/approve", nil, "")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, body = post(t, server.URL+"/api/repos/owner/b/reject", nil, "")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "repository \"owner/b\" is not pending, it is failed\n", body)
+
+	code, _ = post(t, server.URL+"/api/repos/owner/b/retry", nil, "")
+	assert.Equal(t, http.StatusNoContent, code)
+	b, _ := q.Get("owner/b")
+	assert.Equal(t, queue.Discovered, b.State)
+	code, body = post(t, server.URL+"/api/repos/owner/b/retry", nil, "")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "repository \"owner/b\" is not failed, it is discovered\n", body)
+
+	code, _ = get(t, server.URL+"/api/repos/owner/unknown")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestStats(t *testing.T) {
+	q := testQueue(t)
+	a, _ := q.Get("owner/a")
+	a.PullRequest = &queue.PullRequest{
+		Number:   1,
+		URL:      "https://github.com/owner/a/pull/1",
+		State:    "merged",
+		Checkers: []string{"chandir"},
+		Comments: []publisher.Comment{{Author: "alice", Kind: "comment", Body: "Nice catch"}},
+	}
+	require.NoError(t, q.Advance(a, queue.Published))
+	server := httptest.NewServer(Handler(q))
+	defer server.Close()
+
+	code, body := get(t, server.URL+"/stats")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "1 pull requests opened, 1 merged, 0 closed without merge: 100% accepted.")
+	assert.Contains(t, body, "<td>chandir</td>")
+	assert.Contains(t, body, "Nice catch")
+
+	code, body = get(t, server.URL+"/api/stats")
+	assert.Equal(t, http.StatusOK, code)
+	var s stats.Stats
+	require.NoError(t, json.Unmarshal([]byte(body), &s))
+	assert.Equal(t, 1, s.Total.Merged)
+	require.Len(t, s.Owners, 1)
+	assert.Equal(t, "owner", s.Owners[0].Key)
+
+	code, body = get(t, server.URL+"/api/comments")
+	assert.Equal(t, http.StatusOK, code)
+	var comments []stats.Comment
+	require.NoError(t, json.Unmarshal([]byte(body), &comments))
+	require.Len(t, comments, 1)
+	assert.Equal(t, "owner/a", comments[0].Repo)
+	assert.Equal(t, "alice", comments[0].Author)
+}
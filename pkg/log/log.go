@@ -0,0 +1,147 @@
+// Package log is the structured logger of the pipeline. Loggers are passed through contexts, with the fields
+// identifying what is being processed: the repository, its commit, the stage of the pipeline and the checker.
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Fields of the messages.
+const (
+	// FieldRepo is the OWNER/NAME of the repository
+	FieldRepo = "repo"
+	// FieldSHA is the commit of the clone of the repository
+	FieldSHA = "sha"
+	// FieldStage is the stage of the pipeline: discover, filter, clone, analyse, verify, review or publish
+	FieldStage = "stage"
+	// FieldChecker is the name of the checker
+	FieldChecker = "checker"
+)
+
+type contextKey struct{}
+
+// Setup configures the standard logger, used by contexts without logger: its format, text or json, and level.
+func Setup(format, level string) error {
+	formatter, err := NewFormatter(format)
+	if err != nil {
+		return err
+	}
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	logrus.SetFormatter(formatter)
+	logrus.SetLevel(lvl)
+	// Loggers of repositories write to the same output, each message must be written at once
+	logrus.SetOutput(&lockedWriter{w: os.Stderr})
+
+	return nil
+}
+
+// NewFormatter returns the formatter of format, text or json.
+func NewFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case "text":
+		return &logrus.TextFormatter{}, nil
+	case "json":
+		return &logrus.JSONFormatter{}, nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, expecting text or json", format)
+}
+
+// FromContext returns the logger of ctx, the standard logger when ctx has none.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(contextKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// WithFields returns a copy of ctx whose logger adds fields to its messages.
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	return context.WithValue(ctx, contextKey{}, FromContext(ctx).WithFields(fields))
+}
+
+// WithField returns a copy of ctx whose logger adds the field key to its messages.
+func WithField(ctx context.Context, key string, value interface{}) context.Context {
+	return WithFields(ctx, logrus.Fields{key: value})
+}
+
+// File is the log file of a repository.
+type File struct {
+	file *os.File
+}
+
+// OpenFile returns a copy of ctx whose logger also appends its messages to filename, as JSON.
+// Messages are written to the file until it's closed.
+func OpenFile(ctx context.Context, filename string) (context.Context, *File, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry := FromContext(ctx)
+	parent := entry.Logger
+	logger := &logrus.Logger{
+		Out:       parent.Out,
+		Formatter: parent.Formatter,
+		Hooks:     make(logrus.LevelHooks),
+		Level:     parent.GetLevel(),
+		ExitFunc:  parent.ExitFunc,
+	}
+	for level, hooks := range parent.Hooks {
+		logger.Hooks[level] = append(logger.Hooks[level], hooks...)
+	}
+	logger.AddHook(&fileHook{w: f, formatter: &logrus.JSONFormatter{}})
+
+	ctx = context.WithValue(ctx, contextKey{}, logger.WithFields(entry.Data))
+	return ctx, &File{file: f}, nil
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+// fileHook writes the messages to w, using formatter.
+type fileHook struct {
+	w         io.Writer
+	formatter logrus.Formatter
+}
+
+func (h *fileHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *fileHook) Fire(entry *logrus.Entry) error {
+	b, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.w.Write(b)
+	return err
+}
+
+// lockedWriter serializes the writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
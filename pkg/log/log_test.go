@@ -0,0 +1,103 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testContext returns a context whose logger writes JSON messages to the returned buffer.
+func testContext() (context.Context, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buf
+	logger.Formatter = &logrus.JSONFormatter{}
+	logger.Level = logrus.DebugLevel
+
+	return context.WithValue(context.Background(), contextKey{}, logrus.NewEntry(logger)), &buf
+}
+
+// decode returns the JSON messages of b.
+func decode(t *testing.T, b []byte) []map[string]interface{} {
+	var msgs []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var msg map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &msg), line)
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Equal(t, logrus.StandardLogger(), FromContext(context.Background()).Logger)
+
+	ctx, buf := testContext()
+	ctx = WithField(ctx, FieldStage, "analyse")
+	ctx = WithFields(ctx, logrus.Fields{FieldRepo: "owner/name", FieldSHA: "abc"})
+	FromContext(ctx).WithField(FieldChecker, "chandir").Info("2 changes")
+
+	msgs := decode(t, buf.Bytes())
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "2 changes", msgs[0]["msg"])
+	assert.Equal(t, "analyse", msgs[0][FieldStage])
+	assert.Equal(t, "owner/name", msgs[0][FieldRepo])
+	assert.Equal(t, "abc", msgs[0][FieldSHA])
+	assert.Equal(t, "chandir", msgs[0][FieldChecker])
+}
+
+func TestOpenFile(t *testing.T) {
+	ctx, buf := testContext()
+	ctx = WithField(ctx, FieldRepo, "owner/name")
+	FromContext(ctx).Info("before")
+
+	filename := filepath.Join(t.TempDir(), "owner", "name.log")
+	fileCtx, f, err := OpenFile(ctx, filename)
+	require.NoError(t, err)
+	FromContext(fileCtx).WithField(FieldStage, "clone").Debug("cloned")
+	FromContext(ctx).Info("not in file")
+	require.NoError(t, f.Close())
+
+	// Reopening appends
+	fileCtx, f, err = OpenFile(ctx, filename)
+	require.NoError(t, err)
+	FromContext(fileCtx).Warn("again")
+	require.NoError(t, f.Close())
+
+	b, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	msgs := decode(t, b)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "cloned", msgs[0]["msg"])
+	assert.Equal(t, "debug", msgs[0]["level"])
+	assert.Equal(t, "owner/name", msgs[0][FieldRepo])
+	assert.Equal(t, "clone", msgs[0][FieldStage])
+	assert.Equal(t, "again", msgs[1]["msg"])
+
+	// The messages still go to the parent's output
+	var out []string
+	for _, msg := range decode(t, buf.Bytes()) {
+		out = append(out, msg["msg"].(string))
+	}
+	assert.Equal(t, []string{"before", "cloned", "not in file", "again"}, out)
+}
+
+func TestNewFormatter(t *testing.T) {
+	f, err := NewFormatter("json")
+	require.NoError(t, err)
+	assert.IsType(t, &logrus.JSONFormatter{}, f)
+
+	f, err = NewFormatter("text")
+	require.NoError(t, err)
+	assert.IsType(t, &logrus.TextFormatter{}, f)
+
+	_, err = NewFormatter("xml")
+	assert.EqualError(t, err, `unknown log format "xml", expecting text or json`)
+}
@@ -0,0 +1,159 @@
+// Package metrics exposes the Prometheus metrics of the pipeline, and its health and readiness.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "contributehub"
+
+// Registry is the registry of the metrics, with the Go runtime and process metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// EventsFetched counts the GitHub events fetched by the discoverer
+	EventsFetched = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_fetched_total",
+		Help:      "GitHub events fetched.",
+	})
+
+	// Repositories counts the repositories reaching each state of the queue
+	Repositories = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "repositories_total",
+		Help:      "Repositories reaching each state: discovered, filtered, cloned, analysed, verified, published or failed.",
+	}, []string{"state"})
+
+	// Changes counts the changes made by each checker
+	Changes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "changes_total",
+		Help:      "Changes made by each checker to the analysed repositories.",
+	}, []string{"checker"})
+
+	// CloneDuration observes the duration of the clones
+	CloneDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "clone_duration_seconds",
+		Help:      "Duration of the clones of the repositories.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+	})
+
+	// CloneBytes observes the size of the clones on disk
+	CloneBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "clone_bytes",
+		Help:      "Size of the clones of the repositories on disk.",
+		Buckets:   prometheus.ExponentialBuckets(64<<10, 4, 10),
+	})
+
+	// AnalysisDuration observes the duration of the analysis of the repositories
+	AnalysisDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "analysis_duration_seconds",
+		Help:      "Duration of the analysis of the repositories by the checkers.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+
+	// Verifications counts the verifications of the changes, by outcome
+	Verifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "verifications_total",
+		Help:      "Verifications of the changes made to the repositories, by outcome: passed, broken or unverifiable.",
+	}, []string{"outcome"})
+
+	// GitHubRequests counts the requests to the GitHub API, by status code
+	GitHubRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "github_requests_total",
+		Help:      "Requests to the GitHub API, by status code, \"error\" when the request failed.",
+	}, []string{"code"})
+
+	// GitHubRateLimitRemaining is the number of GitHub API requests left in the current rate limit window
+	GitHubRateLimitRemaining = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "github_rate_limit_remaining",
+		Help:      "GitHub API requests left in the current rate limit window, as of the last response.",
+	})
+
+	// PullRequests counts the pull requests opened, and those merged or closed without merge
+	PullRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pull_requests_total",
+		Help:      "Pull requests opened, merged, or closed without being merged.",
+	}, []string{"state"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		EventsFetched,
+		Repositories,
+		Changes,
+		CloneDuration,
+		CloneBytes,
+		AnalysisDuration,
+		Verifications,
+		GitHubRequests,
+		GitHubRateLimitRemaining,
+		PullRequests,
+	)
+
+	// Export the series before their first increment
+	for _, state := range []string{"opened", "merged", "closed"} {
+		PullRequests.WithLabelValues(state)
+	}
+}
+
+// Transport counts the requests sent to the GitHub API through Base, and records the rate limit of their responses.
+type Transport struct {
+	// Base is the transport sending the requests, http.DefaultTransport when nil
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		GitHubRequests.WithLabelValues("error").Inc()
+		return nil, err
+	}
+
+	GitHubRequests.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		GitHubRateLimitRemaining.Set(float64(remaining))
+	}
+
+	return resp, nil
+}
+
+// Handler serves the metrics on /metrics, the health on /healthz and the readiness on /readyz.
+// The process is healthy as long as it serves, it's ready when ready returns nil.
+func Handler(ready func() error) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry}))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+
+	return mux
+}
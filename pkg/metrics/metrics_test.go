@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "4321")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{}}
+	ok := testutil.ToFloat64(GitHubRequests.WithLabelValues("200"))
+	missing := testutil.ToFloat64(GitHubRequests.WithLabelValues("404"))
+	failed := testutil.ToFloat64(GitHubRequests.WithLabelValues("error"))
+
+	for _, path := range []string{"/", "/", "/missing"} {
+		resp, err := client.Get(server.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	_, err := client.Get("http://127.0.0.1:0/")
+	require.Error(t, err)
+
+	assert.Equal(t, ok+2, testutil.ToFloat64(GitHubRequests.WithLabelValues("200")))
+	assert.Equal(t, missing+1, testutil.ToFloat64(GitHubRequests.WithLabelValues("404")))
+	assert.Equal(t, failed+1, testutil.ToFloat64(GitHubRequests.WithLabelValues("error")))
+	assert.Equal(t, 4321.0, testutil.ToFloat64(GitHubRateLimitRemaining))
+}
+
+func TestHandler(t *testing.T) {
+	var notReady error
+	server := httptest.NewServer(Handler(func() error { return notReady }))
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	code, _ := get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+
+	notReady = errors.New("stopping")
+	code, body := get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "stopping\n", body)
+	code, _ = get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, body = get("/metrics")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `contributehub_pull_requests_total{state="merged"} 0`)
+	assert.Contains(t, body, "contributehub_clone_duration_seconds_bucket")
+	assert.Contains(t, body, "go_goroutines")
+}
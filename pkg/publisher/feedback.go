@@ -0,0 +1,120 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Comment is a comment on a pull request, of someone else than the user of the client.
+type Comment struct {
+	Author string `json:"author"`
+	// Association is the relationship of the author with the repository, e.g. OWNER, MEMBER or NONE,
+	// unknown for the reviews
+	Association string `json:"association,omitempty"`
+	// Kind is comment for the comments of the conversation, review for the reviews, and review_comment
+	// for the comments of the reviews on the changed lines
+	Kind string `json:"kind"`
+	// State is the state of a review: approved, changes_requested or commented
+	State string `json:"state,omitempty"`
+	// Path is the file of a review comment
+	Path      string    `json:"path,omitempty"`
+	Body      string    `json:"body"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Feedback is the feedback on a pull request, from others than the user of the client.
+type Feedback struct {
+	// Review is the state of the last review approving or requesting changes: approved or changes_requested,
+	// empty without such review
+	Review string
+	// Comments are sorted by creation
+	Comments []Comment
+}
+
+// Feedback returns the feedback on the pull request number of repo: the first 100 comments, reviews
+// and review comments.
+func (g *GitHub) Feedback(ctx context.Context, repo *github.Repository, number int) (*Feedback, error) {
+	login, err := g.user(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+	page := github.ListOptions{PerPage: 100}
+	feedback := &Feedback{}
+
+	comments, _, err := g.Client.Issues.ListComments(ctx, owner, name, number, &github.IssueListCommentsOptions{ListOptions: page})
+	if err != nil {
+		return nil, fmt.Errorf("error listing comments of pull request %d of %s/%s: %v", number, owner, name, err)
+	}
+	for _, c := range comments {
+		if c.GetUser().GetLogin() == login {
+			continue
+		}
+		feedback.Comments = append(feedback.Comments, Comment{
+			Author:      c.GetUser().GetLogin(),
+			Association: c.GetAuthorAssociation(),
+			Kind:        "comment",
+			Body:        c.GetBody(),
+			URL:         c.GetHTMLURL(),
+			CreatedAt:   c.GetCreatedAt(),
+		})
+	}
+
+	reviews, _, err := g.Client.PullRequests.ListReviews(ctx, owner, name, number, &page)
+	if err != nil {
+		return nil, fmt.Errorf("error listing reviews of pull request %d of %s/%s: %v", number, owner, name, err)
+	}
+	for _, r := range reviews {
+		if r.GetUser().GetLogin() == login {
+			continue
+		}
+		// Reviews are listed in chronological order
+		state := strings.ToLower(r.GetState())
+		if state == "approved" || state == "changes_requested" {
+			feedback.Review = state
+		}
+		if r.GetBody() == "" {
+			// Only made of review comments
+			continue
+		}
+		feedback.Comments = append(feedback.Comments, Comment{
+			Author:    r.GetUser().GetLogin(),
+			Kind:      "review",
+			State:     state,
+			Body:      r.GetBody(),
+			URL:       r.GetHTMLURL(),
+			CreatedAt: r.GetSubmittedAt(),
+		})
+	}
+
+	reviewComments, _, err := g.Client.PullRequests.ListComments(ctx, owner, name, number, &github.PullRequestListCommentsOptions{ListOptions: page})
+	if err != nil {
+		return nil, fmt.Errorf("error listing review comments of pull request %d of %s/%s: %v", number, owner, name, err)
+	}
+	for _, c := range reviewComments {
+		if c.GetUser().GetLogin() == login {
+			continue
+		}
+		feedback.Comments = append(feedback.Comments, Comment{
+			Author:      c.GetUser().GetLogin(),
+			Association: c.GetAuthorAssociation(),
+			Kind:        "review_comment",
+			Path:        c.GetPath(),
+			Body:        c.GetBody(),
+			URL:         c.GetHTMLURL(),
+			CreatedAt:   c.GetCreatedAt(),
+		})
+	}
+
+	sort.SliceStable(feedback.Comments, func(i, j int) bool {
+		return feedback.Comments[i].CreatedAt.Before(feedback.Comments[j].CreatedAt)
+	})
+	return feedback, nil
+}
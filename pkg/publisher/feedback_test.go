@@ -0,0 +1,48 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitHubFeedback(t *testing.T) {
+	fake := newFakeGitHub(t)
+	fake.HandleFunc("GET /repos/owner/name/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"user": {"login": "bot"}, "body": "Rebased", "created_at": "2026-10-01T00:00:00Z"},
+			{"user": {"login": "alice"}, "author_association": "OWNER", "body": "Thanks!", "html_url": "c1", "created_at": "2026-10-03T00:00:00Z"}
+		]`)
+	})
+	fake.HandleFunc("GET /repos/owner/name/pulls/7/reviews", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"user": {"login": "bob"}, "state": "CHANGES_REQUESTED", "body": "Keep the API", "html_url": "r1", "submitted_at": "2026-10-02T00:00:00Z"},
+			{"user": {"login": "bob"}, "state": "COMMENTED", "body": "", "submitted_at": "2026-10-04T00:00:00Z"}
+		]`)
+	})
+	fake.HandleFunc("GET /repos/owner/name/pulls/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"user": {"login": "bob"}, "author_association": "MEMBER", "path": "main.go", "body": "Exported", "html_url": "rc1", "created_at": "2026-10-04T00:00:00Z"}
+		]`)
+	})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	g, repo := newTestGitHub(server)
+
+	feedback, err := g.Feedback(context.Background(), repo, 7)
+	require.NoError(t, err)
+	assert.Equal(t, "changes_requested", feedback.Review)
+
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 0, 0, 0, 0, time.UTC) }
+	assert.Equal(t, []Comment{
+		{Author: "bob", Kind: "review", State: "changes_requested", Body: "Keep the API", URL: "r1", CreatedAt: day(2)},
+		{Author: "alice", Association: "OWNER", Kind: "comment", Body: "Thanks!", URL: "c1", CreatedAt: day(3)},
+		{Author: "bob", Association: "MEMBER", Kind: "review_comment", Path: "main.go", Body: "Exported", URL: "rc1", CreatedAt: day(4)},
+	}, feedback.Comments)
+}
@@ -0,0 +1,383 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// PullRequest is a pull request to open, changing files of a repository.
+type PullRequest struct {
+	// Repo is the upstream repository
+	Repo *github.Repository
+	// Base is the commit the changes apply to, on the default branch of Repo
+	Base string
+	// Files are the contents of the changed files, by path relative to the root of the repository
+	Files map[string]File
+	// Branch is the branch of the changes in the fork of the repository
+	Branch string
+	// Checkers are the checkers having made the changes, recorded in the body to find the pull request again
+	Checkers []string
+
+	Title string
+	Body  string
+}
+
+// File is the new content of a changed file.
+type File struct {
+	Content    []byte
+	Executable bool
+	// Original is the content of the file in Base
+	Original []byte
+}
+
+// checkersMarker is the hidden comment appended to the bodies of the pull requests, listing their checkers.
+var checkersMarker = regexp.MustCompile(`<!-- contributehub checkers: ([^>]*) -->`)
+
+// withdrawnMarker is the hidden comment appended to the bodies of the pull requests closed by Close.
+const withdrawnMarker = "<!-- contributehub withdrawn -->"
+
+// body returns the body of pr, with the marker of its checkers.
+func (pr *PullRequest) body() string {
+	return fmt.Sprintf("%s\n\n<!-- contributehub checkers: %s -->\n", strings.TrimRight(pr.Body, "\n"), strings.Join(pr.Checkers, " "))
+}
+
+// GitHub opens pull requests from forks of the repositories owned by the user of Client.
+// The commits are created through the API: the clones, usually shallow, are never pushed.
+type GitHub struct {
+	Client *github.Client
+
+	mu sync.Mutex
+	// login is the login of the user of Client, once known
+	login string
+}
+
+// Open opens pr and returns it. The repository is forked first if needed, GitHub forks asynchronously
+// so it fails until the fork is ready. It's idempotent: retrying after a failure, or rebasing, the branch
+// is reset and the pull request already opened is returned, with the title and body of pr.
+func (g *GitHub) Open(ctx context.Context, pr *PullRequest) (*github.PullRequest, error) {
+	login, err := g.user(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, name := pr.Repo.GetOwner().GetLogin(), pr.Repo.GetName()
+	if _, _, err := g.Client.Repositories.CreateFork(ctx, owner, name, nil); err != nil {
+		if _, ok := err.(*github.AcceptedError); !ok {
+			return nil, fmt.Errorf("error forking %s/%s: %v", owner, name, err)
+		}
+	}
+
+	commit, err := g.commit(ctx, login, name, pr)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.setBranch(ctx, login, name, pr.Branch, commit); err != nil {
+		return nil, err
+	}
+
+	head := login + ":" + pr.Branch
+	opened, _, err := g.Client.PullRequests.List(ctx, owner, name, &github.PullRequestListOptions{Head: head})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pull requests of %s/%s: %v", owner, name, err)
+	}
+	if len(opened) > 0 {
+		number := opened[0].GetNumber()
+		pull, _, err := g.Client.PullRequests.Edit(ctx, owner, name, number, &github.PullRequest{
+			Title: github.String(pr.Title),
+			Body:  github.String(pr.body()),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error editing pull request %d of %s/%s: %v", number, owner, name, err)
+		}
+		return pull, nil
+	}
+
+	pull, _, err := g.Client.PullRequests.Create(ctx, owner, name, &github.NewPullRequest{
+		Title:               github.String(pr.Title),
+		Head:                github.String(head),
+		Base:                github.String(pr.Repo.GetDefaultBranch()),
+		Body:                github.String(pr.body()),
+		MaintainerCanModify: github.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error opening pull request on %s/%s: %v", owner, name, err)
+	}
+
+	return pull, nil
+}
+
+// user returns the login of the user of the client.
+func (g *GitHub) user(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.login == "" {
+		user, _, err := g.Client.Users.Get(ctx, "")
+		if err != nil {
+			return "", fmt.Errorf("error getting GitHub user: %v", err)
+		}
+		g.login = user.GetLogin()
+	}
+	return g.login, nil
+}
+
+// commit creates the commit of the changes of pr in the fork owner/name, and returns its SHA.
+func (g *GitHub) commit(ctx context.Context, owner, name string, pr *PullRequest) (string, error) {
+	base, _, err := g.Client.Git.GetCommit(ctx, owner, name, pr.Base)
+	if err != nil {
+		return "", fmt.Errorf("error getting commit %s of %s/%s: %v", pr.Base, owner, name, err)
+	}
+
+	paths := make([]string, 0, len(pr.Files))
+	for path := range pr.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var entries []github.TreeEntry
+	for _, path := range paths {
+		file := pr.Files[path]
+		mode := "100644"
+		if file.Executable {
+			mode = "100755"
+		}
+		entries = append(entries, github.TreeEntry{
+			Path:    github.String(path),
+			Mode:    github.String(mode),
+			Type:    github.String("blob"),
+			Content: github.String(string(file.Content)),
+		})
+	}
+
+	tree, _, err := g.Client.Git.CreateTree(ctx, owner, name, base.GetTree().GetSHA(), entries)
+	if err != nil {
+		return "", fmt.Errorf("error creating tree in %s/%s: %v", owner, name, err)
+	}
+
+	commit, _, err := g.Client.Git.CreateCommit(ctx, owner, name, &github.Commit{
+		Message: github.String(pr.Title),
+		Tree:    &github.Tree{SHA: tree.SHA},
+		Parents: []github.Commit{{SHA: github.String(pr.Base)}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating commit in %s/%s: %v", owner, name, err)
+	}
+
+	return commit.GetSHA(), nil
+}
+
+// setBranch points branch of the repository owner/name to commit, creating it if needed.
+func (g *GitHub) setBranch(ctx context.Context, owner, name, branch, commit string) error {
+	ref := &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: github.String(commit)},
+	}
+
+	_, resp, err := g.Client.Git.CreateRef(ctx, owner, name, ref)
+	if err != nil && resp != nil && resp.StatusCode == http.StatusUnprocessableEntity {
+		// The branch exists, from a previous attempt
+		_, _, err = g.Client.Git.UpdateRef(ctx, owner, name, ref, true)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating branch %s in %s/%s: %v", branch, owner, name, err)
+	}
+
+	return nil
+}
+
+// Previous is a pull request opened before by the user of the client.
+type Previous struct {
+	Number int
+	URL    string
+	// State is open, closed or merged
+	State    string
+	ClosedAt time.Time
+	// Withdrawn is true when the pull request was closed by Close, not by the maintainers
+	Withdrawn bool
+	// Checkers are the checkers whose changes are in the pull request
+	Checkers []string
+}
+
+// Previous returns the pull requests opened on repo by the user of the client, with the changes of checkers.
+// Pull requests opened by the user otherwise are ignored.
+func (g *GitHub) Previous(ctx context.Context, repo *github.Repository) ([]*Previous, error) {
+	login, err := g.user(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+	query := fmt.Sprintf("repo:%s/%s is:pr author:%s", owner, name, login)
+	result, _, err := g.Client.Search.Issues(ctx, query, &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 100}})
+	if err != nil {
+		return nil, fmt.Errorf("error searching pull requests of %s/%s: %v", owner, name, err)
+	}
+
+	var previous []*Previous
+	for _, issue := range result.Issues {
+		match := checkersMarker.FindStringSubmatch(issue.GetBody())
+		if match == nil {
+			continue
+		}
+
+		pr := &Previous{
+			Number:    issue.GetNumber(),
+			URL:       issue.GetHTMLURL(),
+			State:     issue.GetState(),
+			ClosedAt:  issue.GetClosedAt(),
+			Withdrawn: strings.Contains(issue.GetBody(), withdrawnMarker),
+			Checkers:  strings.Fields(match[1]),
+		}
+		if pr.State == "closed" {
+			// Issues don't tell whether they were merged
+			pull, err := g.Get(ctx, repo, pr.Number)
+			if err != nil {
+				return nil, err
+			}
+			if pull.GetMerged() {
+				pr.State = "merged"
+			}
+		}
+		previous = append(previous, pr)
+	}
+
+	return previous, nil
+}
+
+// Duplicates are the pull requests opened before with changes of the same checkers as a new one.
+type Duplicates struct {
+	// Open are the open pull requests, by checker
+	Open map[string]*Previous
+	// Closed is the pull request closed without being merged last, by the maintainers, nil if none
+	Closed *Previous
+}
+
+// FindDuplicates returns the Duplicates among previous of a new pull request with the changes of checkers.
+// The pull request number, when not 0, is the one of these changes, being updated: it isn't a duplicate.
+// Merged pull requests aren't duplicates: the checkers may have found new issues since. Neither are the
+// withdrawn ones: they were closed by the pipeline itself, not rejected.
+func FindDuplicates(previous []*Previous, checkers []string, number int) Duplicates {
+	wanted := make(map[string]bool)
+	for _, checker := range checkers {
+		wanted[checker] = true
+	}
+
+	d := Duplicates{Open: make(map[string]*Previous)}
+	for _, pr := range previous {
+		if pr.Number == number {
+			continue
+		}
+		for _, checker := range pr.Checkers {
+			if !wanted[checker] {
+				continue
+			}
+			switch pr.State {
+			case "open":
+				d.Open[checker] = pr
+			case "closed":
+				if pr.Withdrawn {
+					continue
+				}
+				if d.Closed == nil || pr.ClosedAt.After(d.Closed.ClosedAt) {
+					d.Closed = pr
+				}
+			}
+		}
+	}
+
+	return d
+}
+
+// Upstream is the state of the files changed by a pull request, on the default branch of the upstream repository.
+type Upstream int
+
+const (
+	// Unchanged files are the same as in the base of the pull request
+	Unchanged Upstream = iota
+	// Fixed files already have the changes of the pull request
+	Fixed
+	// Changed files were changed otherwise, the changes must be made again
+	Changed
+)
+
+// Upstream returns the state of the files changed by pr on the default branch of its repository.
+func (g *GitHub) Upstream(ctx context.Context, pr *PullRequest) (Upstream, error) {
+	owner, name := pr.Repo.GetOwner().GetLogin(), pr.Repo.GetName()
+	branch, _, err := g.Client.Repositories.GetBranch(ctx, owner, name, pr.Repo.GetDefaultBranch())
+	if err != nil {
+		return Unchanged, fmt.Errorf("error getting default branch of %s/%s: %v", owner, name, err)
+	}
+	head := branch.GetCommit().GetSHA()
+	if head == pr.Base {
+		return Unchanged, nil
+	}
+
+	unchanged, fixed := true, true
+	for path, file := range pr.Files {
+		content, _, resp, err := g.Client.Repositories.GetContents(ctx, owner, name, path, &github.RepositoryContentGetOptions{Ref: head})
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			// The file was removed
+			return Changed, nil
+		}
+		if err != nil {
+			return Unchanged, fmt.Errorf("error getting %s of %s/%s: %v", path, owner, name, err)
+		}
+		s, err := content.GetContent()
+		if err != nil {
+			return Unchanged, fmt.Errorf("error decoding %s of %s/%s: %v", path, owner, name, err)
+		}
+
+		unchanged = unchanged && bytes.Equal([]byte(s), file.Original)
+		fixed = fixed && bytes.Equal([]byte(s), file.Content)
+	}
+
+	switch {
+	case unchanged:
+		return Unchanged, nil
+	case fixed:
+		return Fixed, nil
+	}
+	return Changed, nil
+}
+
+// Get returns the pull request number of repo.
+func (g *GitHub) Get(ctx context.Context, repo *github.Repository, number int) (*github.PullRequest, error) {
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+	pull, _, err := g.Client.PullRequests.Get(ctx, owner, name, number)
+	if err != nil {
+		return nil, fmt.Errorf("error getting pull request %d of %s/%s: %v", number, owner, name, err)
+	}
+
+	return pull, nil
+}
+
+// Close withdraws the pull request number of repo, explaining why in comment. Its body is marked as withdrawn:
+// it isn't a rejection of its checkers for FindDuplicates.
+func (g *GitHub) Close(ctx context.Context, repo *github.Repository, number int, comment string) error {
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+	pull, err := g.Get(ctx, repo, number)
+	if err != nil {
+		return err
+	}
+	if _, _, err := g.Client.Issues.CreateComment(ctx, owner, name, number, &github.IssueComment{Body: github.String(comment)}); err != nil {
+		return fmt.Errorf("error commenting pull request %d of %s/%s: %v", number, owner, name, err)
+	}
+	body := pull.GetBody()
+	if !strings.Contains(body, withdrawnMarker) {
+		body += withdrawnMarker + "\n"
+	}
+	if _, _, err := g.Client.PullRequests.Edit(ctx, owner, name, number, &github.PullRequest{State: github.String("closed"), Body: github.String(body)}); err != nil {
+		return fmt.Errorf("error closing pull request %d of %s/%s: %v", number, owner, name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,360 @@
+package publisher
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitHub is the part of the GitHub API used to open pull requests, with the fork bot/name of owner/name.
+type fakeGitHub struct {
+	*http.ServeMux
+
+	trees    []map[string]interface{}
+	branches map[string]string
+	// pulls are the requests opening pull requests, numbered from 1
+	pulls []map[string]interface{}
+	// issues are the search results of the pull requests of bot
+	issues []github.Issue
+	// merged are the numbers of the merged pull requests
+	merged map[int]bool
+	// head is the head of the default branch, and files the contents of the files there
+	head  string
+	files map[string]string
+	// comments are the comments of the pull requests, and closed their closed pull requests
+	comments map[int][]string
+	closed   map[int]bool
+}
+
+func newFakeGitHub(t *testing.T) *fakeGitHub {
+	f := &fakeGitHub{
+		ServeMux: http.NewServeMux(),
+		branches: make(map[string]string),
+		merged:   make(map[int]bool),
+		head:     "base",
+		files:    make(map[string]string),
+		comments: make(map[int][]string),
+		closed:   make(map[int]bool),
+	}
+
+	decode := func(r *http.Request) map[string]interface{} {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		return body
+	}
+
+	f.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login": "bot"}`)
+	})
+	f.HandleFunc("POST /repos/owner/name/forks", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{"name": "name", "owner": {"login": "bot"}}`)
+	})
+	f.HandleFunc("GET /repos/bot/name/git/commits/base", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sha": "base", "tree": {"sha": "base-tree"}}`)
+	})
+	f.HandleFunc("POST /repos/bot/name/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		f.trees = append(f.trees, decode(r))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"sha": "tree"}`)
+	})
+	f.HandleFunc("POST /repos/bot/name/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		body := decode(r)
+		assert.Equal(t, "tree", body["tree"])
+		assert.Equal(t, []interface{}{"base"}, body["parents"])
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"sha": "commit"}`)
+	})
+	f.HandleFunc("POST /repos/bot/name/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		body := decode(r)
+		ref := body["ref"].(string)
+		if _, ok := f.branches[ref]; ok {
+			http.Error(w, `{"message": "Reference already exists"}`, http.StatusUnprocessableEntity)
+			return
+		}
+		f.branches[ref] = body["sha"].(string)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	f.HandleFunc("PATCH /repos/bot/name/git/refs/heads/{branch...}", func(w http.ResponseWriter, r *http.Request) {
+		body := decode(r)
+		assert.Equal(t, true, body["force"])
+		f.branches["refs/heads/"+r.PathValue("branch")] = body["sha"].(string)
+		fmt.Fprint(w, `{}`)
+	})
+	f.HandleFunc("GET /repos/owner/name/pulls", func(w http.ResponseWriter, r *http.Request) {
+		var pulls []*github.PullRequest
+		for i, pull := range f.pulls {
+			if pull["head"] == r.URL.Query().Get("head") {
+				pulls = append(pulls, &github.PullRequest{Number: github.Int(i + 1)})
+			}
+		}
+		json.NewEncoder(w).Encode(pulls)
+	})
+	f.HandleFunc("POST /repos/owner/name/pulls", func(w http.ResponseWriter, r *http.Request) {
+		f.pulls = append(f.pulls, decode(r))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&github.PullRequest{Number: github.Int(len(f.pulls))})
+	})
+	f.HandleFunc("GET /search/issues", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "repo:owner/name is:pr author:bot", r.URL.Query().Get("q"))
+		json.NewEncoder(w).Encode(&github.IssuesSearchResult{Issues: f.issues})
+	})
+	f.HandleFunc("GET /repos/owner/name/pulls/{number}", func(w http.ResponseWriter, r *http.Request) {
+		number, _ := strconv.Atoi(r.PathValue("number"))
+		pull := &github.PullRequest{Number: github.Int(number), Merged: github.Bool(f.merged[number])}
+		if number <= len(f.pulls) {
+			pull.Body = github.String(f.pulls[number-1]["body"].(string))
+		}
+		json.NewEncoder(w).Encode(pull)
+	})
+	f.HandleFunc("PATCH /repos/owner/name/pulls/{number}", func(w http.ResponseWriter, r *http.Request) {
+		number, _ := strconv.Atoi(r.PathValue("number"))
+		body := decode(r)
+		if body["state"] == "closed" {
+			f.closed[number] = true
+		}
+		if number <= len(f.pulls) {
+			for _, field := range []string{"title", "body"} {
+				if value, ok := body[field]; ok {
+					f.pulls[number-1][field] = value
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(&github.PullRequest{Number: github.Int(number)})
+	})
+	f.HandleFunc("POST /repos/owner/name/issues/{number}/comments", func(w http.ResponseWriter, r *http.Request) {
+		number, _ := strconv.Atoi(r.PathValue("number"))
+		f.comments[number] = append(f.comments[number], decode(r)["body"].(string))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{}`)
+	})
+	f.HandleFunc("GET /repos/owner/name/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"name": "main", "commit": {"sha": %q}}`, f.head)
+	})
+	f.HandleFunc("GET /repos/owner/name/contents/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, f.head, r.URL.Query().Get("ref"))
+		content, ok := f.files[r.PathValue("path")]
+		if !ok {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(&github.RepositoryContent{
+			Type:     github.String("file"),
+			Encoding: github.String("base64"),
+			Content:  github.String(base64.StdEncoding.EncodeToString([]byte(content))),
+		})
+	})
+
+	return f
+}
+
+// newTestGitHub returns a GitHub calling server, and the repository owner/name.
+func newTestGitHub(server *httptest.Server) (*GitHub, *github.Repository) {
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	return &GitHub{Client: client}, &github.Repository{
+		Owner:         &github.User{Login: github.String("owner")},
+		Name:          github.String("name"),
+		DefaultBranch: github.String("main"),
+	}
+}
+
+func TestGitHubOpen(t *testing.T) {
+	fake := newFakeGitHub(t)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	g, repo := newTestGitHub(server)
+
+	pr := &PullRequest{
+		Repo: repo,
+		Base: "base",
+		Files: map[string]File{
+			"main.go":     {Content: []byte("package main\n")},
+			"cmd/run.sh":  {Content: []byte("#!/bin/sh\n"), Executable: true},
+			"pkg/a/a.go":  {Content: []byte("package a\n")},
+			"pkg/a/b.go":  {Content: []byte("package a\n")},
+			"pkg/a/c.txt": {Content: []byte("c\n")},
+		},
+		Branch:   "contributehub/chandir",
+		Checkers: []string{"chandir"},
+		Title:    "Narrow channel directions",
+		Body:     "Body",
+	}
+
+	pull, err := g.Open(context.Background(), pr)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pull.GetNumber())
+
+	require.Len(t, fake.pulls, 1)
+	assert.Equal(t, "bot:contributehub/chandir", fake.pulls[0]["head"])
+	assert.Equal(t, "main", fake.pulls[0]["base"])
+	assert.Equal(t, "Narrow channel directions", fake.pulls[0]["title"])
+	assert.Equal(t, "Body\n\n<!-- contributehub checkers: chandir -->\n", fake.pulls[0]["body"])
+	assert.Equal(t, "commit", fake.branches["refs/heads/contributehub/chandir"])
+
+	require.Len(t, fake.trees, 1)
+	assert.Equal(t, "base-tree", fake.trees[0]["base_tree"])
+	entries := fake.trees[0]["tree"].([]interface{})
+	require.Len(t, entries, 5)
+	assert.Equal(t, map[string]interface{}{
+		"path":    "cmd/run.sh",
+		"mode":    "100755",
+		"type":    "blob",
+		"content": "#!/bin/sh\n",
+	}, entries[0])
+	assert.Equal(t, "100644", entries[1].(map[string]interface{})["mode"])
+
+	// Retrying, or rebasing, resets the branch and returns the pull request already opened, edited
+	fake.branches["refs/heads/contributehub/chandir"] = "old"
+	pr.Title = "Narrow 2 channel directions"
+	pull, err = g.Open(context.Background(), pr)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pull.GetNumber())
+	assert.Len(t, fake.pulls, 1)
+	assert.Equal(t, "commit", fake.branches["refs/heads/contributehub/chandir"])
+	assert.Equal(t, "Narrow 2 channel directions", fake.pulls[0]["title"])
+	assert.Equal(t, "Body\n\n<!-- contributehub checkers: chandir -->\n", fake.pulls[0]["body"])
+}
+
+func TestGitHubPrevious(t *testing.T) {
+	fake := newFakeGitHub(t)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	g, repo := newTestGitHub(server)
+
+	closedAt := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	fake.issues = []github.Issue{
+		{Number: github.Int(1), State: github.String("open"), Body: github.String("Fix\n\n<!-- contributehub checkers: chandir other -->\n")},
+		{Number: github.Int(2), State: github.String("closed"), ClosedAt: &closedAt, Body: github.String("<!-- contributehub checkers: chandir -->")},
+		{Number: github.Int(3), State: github.String("closed"), ClosedAt: &closedAt, Body: github.String("<!-- contributehub checkers: chandir -->")},
+		{Number: github.Int(5), State: github.String("closed"), ClosedAt: &closedAt, Body: github.String("<!-- contributehub checkers: chandir -->\n<!-- contributehub withdrawn -->\n")},
+		// Opened by hand
+		{Number: github.Int(4), State: github.String("open"), Body: github.String("Fix typo")},
+	}
+	fake.merged[3] = true
+
+	previous, err := g.Previous(context.Background(), repo)
+	require.NoError(t, err)
+	require.Len(t, previous, 4)
+	assert.Equal(t, &Previous{Number: 1, State: "open", Checkers: []string{"chandir", "other"}}, previous[0])
+	assert.Equal(t, &Previous{Number: 2, State: "closed", ClosedAt: closedAt, Checkers: []string{"chandir"}}, previous[1])
+	assert.Equal(t, "merged", previous[2].State)
+	assert.Equal(t, &Previous{Number: 5, State: "closed", ClosedAt: closedAt, Withdrawn: true, Checkers: []string{"chandir"}}, previous[3])
+}
+
+func TestFindDuplicates(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 0, 0, 0, 0, time.UTC) }
+	previous := []*Previous{
+		{Number: 1, State: "open", Checkers: []string{"a", "b"}},
+		{Number: 2, State: "closed", ClosedAt: day(2), Checkers: []string{"a"}},
+		{Number: 3, State: "closed", ClosedAt: day(3), Checkers: []string{"b"}},
+		{Number: 4, State: "closed", ClosedAt: day(4), Checkers: []string{"c"}},
+		{Number: 5, State: "merged", ClosedAt: day(5), Checkers: []string{"a"}},
+		{Number: 6, State: "closed", ClosedAt: day(6), Withdrawn: true, Checkers: []string{"a", "b"}},
+	}
+
+	d := FindDuplicates(previous, []string{"a"}, 0)
+	assert.Equal(t, map[string]*Previous{"a": previous[0]}, d.Open)
+	assert.Equal(t, previous[1], d.Closed)
+
+	d = FindDuplicates(previous, []string{"a", "b"}, 0)
+	assert.Equal(t, map[string]*Previous{"a": previous[0], "b": previous[0]}, d.Open)
+	assert.Equal(t, previous[2], d.Closed)
+
+	// The pull request being updated isn't a duplicate
+	d = FindDuplicates(previous, []string{"b"}, 1)
+	assert.Empty(t, d.Open)
+	assert.Equal(t, previous[2], d.Closed)
+
+	d = FindDuplicates(previous, []string{"d"}, 0)
+	assert.Empty(t, d.Open)
+	assert.Nil(t, d.Closed)
+}
+
+func TestGitHubUpstream(t *testing.T) {
+	fake := newFakeGitHub(t)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	g, repo := newTestGitHub(server)
+
+	pr := &PullRequest{
+		Repo: repo,
+		Base: "base",
+		Files: map[string]File{
+			"a.go": {Original: []byte("a\n"), Content: []byte("A\n")},
+			"b.go": {Original: []byte("b\n"), Content: []byte("B\n")},
+		},
+	}
+
+	for _, test := range []struct {
+		name  string
+		head  string
+		files map[string]string
+		want  Upstream
+	}{
+		{"same head", "base", nil, Unchanged},
+		{"other files changed", "head", map[string]string{"a.go": "a\n", "b.go": "b\n"}, Unchanged},
+		{"fixed", "head", map[string]string{"a.go": "A\n", "b.go": "B\n"}, Fixed},
+		{"partly fixed", "head", map[string]string{"a.go": "A\n", "b.go": "b\n"}, Changed},
+		{"changed", "head", map[string]string{"a.go": "a\n", "b.go": "b\nc\n"}, Changed},
+		{"removed", "head", map[string]string{"a.go": "a\n"}, Changed},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fake.head = test.head
+			fake.files = test.files
+			upstream, err := g.Upstream(context.Background(), pr)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, upstream)
+		})
+	}
+}
+
+func TestGitHubClose(t *testing.T) {
+	fake := newFakeGitHub(t)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	g, repo := newTestGitHub(server)
+
+	pull, err := g.Open(context.Background(), &PullRequest{Repo: repo, Base: "base", Branch: "fix", Checkers: []string{"chandir"}, Body: "Body"})
+	require.NoError(t, err)
+	require.NoError(t, g.Close(context.Background(), repo, pull.GetNumber(), "Conflicting"))
+	assert.Equal(t, []string{"Conflicting"}, fake.comments[1])
+	assert.True(t, fake.closed[1])
+	assert.Equal(t, "Body\n\n<!-- contributehub checkers: chandir -->\n<!-- contributehub withdrawn -->\n", fake.pulls[0]["body"])
+}
+
+func TestParseMode(t *testing.T) {
+	for _, s := range []string{"dry-run", "review", "auto"} {
+		mode, err := ParseMode(s)
+		require.NoError(t, err)
+		assert.Equal(t, Mode(s), mode)
+	}
+
+	_, err := ParseMode("yolo")
+	assert.EqualError(t, err, `unknown publish mode "yolo", expecting dry-run, review or auto`)
+}
+
+func TestParseConflictAction(t *testing.T) {
+	for _, s := range []string{"rebase", "close"} {
+		action, err := ParseConflictAction(s)
+		require.NoError(t, err)
+		assert.Equal(t, ConflictAction(s), action)
+	}
+
+	_, err := ParseConflictAction("merge")
+	assert.EqualError(t, err, `unknown conflict action "merge", expecting rebase or close`)
+}
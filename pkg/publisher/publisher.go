@@ -0,0 +1,45 @@
+// Package publisher sends the verified changes upstream, as GitHub pull requests, following the publish
+// policy of the checkers having made them.
+package publisher
+
+import "fmt"
+
+// Mode is how the changes of a checker are published.
+type Mode string
+
+const (
+	// DryRun changes are only recorded, as patches
+	DryRun Mode = "dry-run"
+	// Review changes wait for a human approval before being published
+	Review Mode = "review"
+	// Auto changes are published without approval
+	Auto Mode = "auto"
+)
+
+// ParseMode returns the Mode named s.
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(s); mode {
+	case DryRun, Review, Auto:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown publish mode %q, expecting dry-run, review or auto", s)
+}
+
+// ConflictAction is what is done with the open pull requests conflicting with upstream changes.
+type ConflictAction string
+
+const (
+	// RebaseConflicting pull requests are updated with the changes made again on the upstream changes
+	RebaseConflicting ConflictAction = "rebase"
+	// CloseConflicting pull requests are closed
+	CloseConflicting ConflictAction = "close"
+)
+
+// ParseConflictAction returns the ConflictAction named s.
+func ParseConflictAction(s string) (ConflictAction, error) {
+	switch action := ConflictAction(s); action {
+	case RebaseConflicting, CloseConflicting:
+		return action, nil
+	}
+	return "", fmt.Errorf("unknown conflict action %q, expecting rebase or close", s)
+}
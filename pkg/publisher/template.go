@@ -0,0 +1,207 @@
+package publisher
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/segflow/contribuehub/pkg/checker"
+	"github.com/segflow/contribuehub/pkg/codechange"
+	"github.com/segflow/contribuehub/pkg/verify"
+)
+
+// maxDiagnostics is the number of diagnostics of each checker listed in Data, the others are only counted
+const maxDiagnostics = 50
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	// plural formats n with singular or plural depending on n, e.g. "1 issue" or "3 issues"
+	"plural": func(n int, singular, plural string) string {
+		if n == 1 {
+			return "1 " + singular
+		}
+		return fmt.Sprintf("%d %s", n, plural)
+	},
+	// duration formats durations in days when they are whole days, e.g. "30 days"
+	"duration": func(d time.Duration) string {
+		if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+			days := int(d / (24 * time.Hour))
+			if days == 1 {
+				return "1 day"
+			}
+			return fmt.Sprintf("%d days", days)
+		}
+		return d.String()
+	},
+}
+
+// Data is the data of the templates of the pull requests.
+type Data struct {
+	// Repo is the OWNER/NAME of the repository
+	Repo string
+	// Checkers are the checkers having made the changes, sorted by name
+	Checkers []CheckerData
+	// Files are the changed files, sorted by path
+	Files []FileData
+	// Changes is the number of changes
+	Changes int
+
+	// Outcome is the outcome of the verification of the changes, and Steps the outcomes of its steps
+	Outcome string
+	Steps   []verify.StepOutcome
+
+	// ClosedBackoff is the time during which no pull request is opened for the checkers once this one is closed
+	ClosedBackoff time.Duration
+}
+
+// CheckerData is a checker having made changes, with their diagnostics.
+type CheckerData struct {
+	checker.Info
+	// Diagnostics are the first diagnostics of the changes, sorted by file and line,
+	// and More the number of the others
+	Diagnostics []Diagnostic
+	More        int
+}
+
+// Count returns the number of diagnostics.
+func (c CheckerData) Count() int {
+	return len(c.Diagnostics) + c.More
+}
+
+// Diagnostic is the issue fixed by a change.
+type Diagnostic struct {
+	File    string
+	Line    int
+	Message string
+}
+
+// FileData is a changed file, with its number of changes.
+type FileData struct {
+	Path    string
+	Changes int
+}
+
+// NewData returns the Data of the changes of the repository OWNER/NAME repo, by path relative to its root.
+// The changes of unknown checkers are counted, but their checkers aren't listed.
+func NewData(repo string, changes map[string][]codechange.CodeChange) *Data {
+	data := &Data{Repo: repo}
+
+	diagnostics := make(map[string][]Diagnostic)
+	seen := make(map[Diagnostic]bool)
+	for path, fchanges := range changes {
+		data.Files = append(data.Files, FileData{Path: path, Changes: len(fchanges)})
+		data.Changes += len(fchanges)
+		for _, change := range fchanges {
+			// A diagnostic may need several changes
+			d := Diagnostic{File: path, Line: change.Line, Message: change.Message}
+			if !seen[d] {
+				seen[d] = true
+				diagnostics[change.Source] = append(diagnostics[change.Source], d)
+			}
+		}
+	}
+	sort.Slice(data.Files, func(i, j int) bool { return data.Files[i].Path < data.Files[j].Path })
+
+	var names []string
+	for name := range diagnostics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		infos, err := checker.Select([]string{name})
+		if err != nil {
+			continue
+		}
+
+		ds := diagnostics[name]
+		sort.Slice(ds, func(i, j int) bool {
+			if ds[i].File != ds[j].File {
+				return ds[i].File < ds[j].File
+			}
+			return ds[i].Line < ds[j].Line
+		})
+		c := CheckerData{Info: infos[0], Diagnostics: ds}
+		if len(ds) > maxDiagnostics {
+			c.Diagnostics, c.More = ds[:maxDiagnostics], len(ds)-maxDiagnostics
+		}
+		data.Checkers = append(data.Checkers, c)
+	}
+
+	return data
+}
+
+// CheckerNames returns the names of the checkers.
+func (d *Data) CheckerNames() []string {
+	var names []string
+	for _, c := range d.Checkers {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// Issues returns the number of diagnostics of the checkers.
+func (d *Data) Issues() int {
+	n := 0
+	for _, c := range d.Checkers {
+		n += c.Count()
+	}
+	return n
+}
+
+// Templates generate the titles and bodies of the pull requests, from Data.
+type Templates struct {
+	title *template.Template
+	body  *template.Template
+}
+
+// NewTemplates parses the templates title, and of the file bodyFile. The built-in templates are used when empty.
+func NewTemplates(title, bodyFile string) (*Templates, error) {
+	if title == "" {
+		content, err := templateFS.ReadFile("templates/title.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		title = string(content)
+	}
+	titleTemplate, err := template.New("title").Funcs(templateFuncs).Parse(title)
+	if err != nil {
+		return nil, fmt.Errorf("invalid title template: %v", err)
+	}
+
+	var body []byte
+	if bodyFile == "" {
+		body, err = templateFS.ReadFile("templates/body.tmpl")
+	} else {
+		body, err = ioutil.ReadFile(bodyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	bodyTemplate, err := template.New("body").Funcs(templateFuncs).Parse(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid body template: %v", err)
+	}
+
+	return &Templates{title: titleTemplate, body: bodyTemplate}, nil
+}
+
+// Execute returns the title and body of the pull request of data. The title is on a single line.
+func (t *Templates) Execute(data *Data) (string, string, error) {
+	var title, body bytes.Buffer
+	if err := t.title.Execute(&title, data); err != nil {
+		return "", "", fmt.Errorf("error executing title template: %v", err)
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("error executing body template: %v", err)
+	}
+
+	return strings.Join(strings.Fields(title.String()), " "), body.String(), nil
+}
@@ -0,0 +1,120 @@
+package publisher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segflow/contribuehub/pkg/codechange"
+	"github.com/segflow/contribuehub/pkg/verify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testData() *Data {
+	message := "ch is only used to send, it can be chan<- int"
+	data := NewData("owner/name", map[string][]codechange.CodeChange{
+		"main.go": {
+			{Line: 3, Source: "chandir", Message: message},
+			{Line: 12, Source: "chandir", Message: message},
+		},
+		"pkg/a/a.go": {
+			// Two changes of the same diagnostic
+			{Line: 7, Source: "chandir", Message: message},
+			{Line: 7, Source: "chandir", Message: message},
+			{Line: 9, Source: "unknown", Message: "unknown"},
+		},
+	})
+	data.Outcome = "passed"
+	data.Steps = []verify.StepOutcome{{Name: "build", Before: true, After: true}, {Name: "test"}}
+	data.ClosedBackoff = 30 * 24 * time.Hour
+	return data
+}
+
+func TestNewData(t *testing.T) {
+	data := testData()
+	assert.Equal(t, "owner/name", data.Repo)
+	assert.Equal(t, 5, data.Changes)
+	assert.Equal(t, []FileData{{Path: "main.go", Changes: 2}, {Path: "pkg/a/a.go", Changes: 3}}, data.Files)
+	assert.Equal(t, []string{"chandir"}, data.CheckerNames())
+	assert.Equal(t, 3, data.Issues())
+
+	c := data.Checkers[0]
+	assert.NotEmpty(t, c.Rationale)
+	assert.Equal(t, 3, c.Count())
+	assert.Equal(t, []Diagnostic{
+		{File: "main.go", Line: 3, Message: "ch is only used to send, it can be chan<- int"},
+		{File: "main.go", Line: 12, Message: "ch is only used to send, it can be chan<- int"},
+		{File: "pkg/a/a.go", Line: 7, Message: "ch is only used to send, it can be chan<- int"},
+	}, c.Diagnostics)
+}
+
+func TestNewDataMaxDiagnostics(t *testing.T) {
+	var changes []codechange.CodeChange
+	for i := 0; i < maxDiagnostics+10; i++ {
+		changes = append(changes, codechange.CodeChange{Line: i + 1, Source: "chandir", Message: "m"})
+	}
+
+	c := NewData("owner/name", map[string][]codechange.CodeChange{"main.go": changes}).Checkers[0]
+	assert.Len(t, c.Diagnostics, maxDiagnostics)
+	assert.Equal(t, 10, c.More)
+	assert.Equal(t, maxDiagnostics+10, c.Count())
+}
+
+func TestTemplates(t *testing.T) {
+	templates, err := NewTemplates("", "")
+	require.NoError(t, err)
+
+	title, body, err := templates.Execute(testData())
+	require.NoError(t, err)
+	assert.Equal(t, "Fix issues found by chandir", title)
+	for _, s := range []string{
+		"fixes 3 issues found by static analysis, changing 2 files.",
+		"### chandir\n\nNarrows bidirectional channels",
+		"func produce(ch chan<- int) {",
+		"<summary>3 issues</summary>",
+		"- `main.go:12`: ch is only used to send, it can be chan<- int\n",
+		"| `pkg/a/a.go` | 3 |\n",
+		"- `go build`: passed\n",
+		"- `go test`: fails before and after the changes, with no new failure\n",
+		"for these checkers on this repository for 30 days.",
+	} {
+		assert.Contains(t, body, s)
+	}
+}
+
+func TestTemplatesSingular(t *testing.T) {
+	templates, err := NewTemplates("", "")
+	require.NoError(t, err)
+
+	data := NewData("owner/name", map[string][]codechange.CodeChange{
+		"main.go": {{Line: 3, Source: "chandir", Message: "ch is only used to send, it can be chan<- int"}},
+	})
+	_, body, err := templates.Execute(data)
+	require.NoError(t, err)
+	assert.Contains(t, body, "fixes 1 issue found by static analysis, changing 1 file.")
+	assert.Contains(t, body, "<summary>1 issue</summary>")
+}
+
+func TestTemplatesOverride(t *testing.T) {
+	bodyFile := filepath.Join(t.TempDir(), "body.tmpl")
+	require.NoError(t, os.WriteFile(bodyFile, []byte("{{range .Files}}{{.Path}} {{end}}"), 0644))
+
+	templates, err := NewTemplates("{{.Repo}}:\n{{.Changes}} fixes\n", bodyFile)
+	require.NoError(t, err)
+	title, body, err := templates.Execute(testData())
+	require.NoError(t, err)
+	assert.Equal(t, "owner/name: 5 fixes", title)
+	assert.Equal(t, "main.go pkg/a/a.go ", body)
+
+	_, err = NewTemplates("{{.Repo", "")
+	assert.Error(t, err)
+	_, err = NewTemplates("", filepath.Join(t.TempDir(), "missing.tmpl"))
+	assert.Error(t, err)
+
+	templates, err = NewTemplates("{{.Unknown}}", "")
+	require.NoError(t, err)
+	_, _, err = templates.Execute(testData())
+	assert.Error(t, err)
+}
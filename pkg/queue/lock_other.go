@@ -0,0 +1,10 @@
+//go:build !unix
+
+package queue
+
+import "os"
+
+// lock is a no-op: the queue is only locked on Unix systems.
+func lock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package queue
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock takes an exclusive lock on f, released when f is closed, including when the process dies.
+// It returns ErrLocked when another process holds it.
+func lock(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return ErrLocked
+	}
+	return err
+}
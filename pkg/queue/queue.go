@@ -0,0 +1,638 @@
+// Package queue is a durable work queue of repositories, persisted in a directory so that the pipeline
+// resumes where it stopped after a crash or a restart.
+//
+// Each repository is an Item moving through the states of the pipeline, from Discovered to Published.
+// Verified changes may wait for a human approval, in the Pending state, before being published,
+// or only be recorded, in the Recorded state. Changes already proposed or fixed upstream end in the Skipped state.
+// Stages take the items of their input state with Next, and either Advance them to the next state, or Fail them.
+// Failed items are retried with an exponential backoff, and parked in the Failed state after MaxAttempts failures.
+// Each item is a JSON file, replaced atomically on every change.
+//
+// A single process may open the queue, the others can only read its items with Load.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/segflow/contribuehub/pkg/codechange"
+	"github.com/segflow/contribuehub/pkg/publisher"
+	"github.com/segflow/contribuehub/pkg/verify"
+)
+
+// State is the progress of a repository in the pipeline.
+type State string
+
+const (
+	// Discovered repositories wait to be filtered
+	Discovered State = "discovered"
+	// Filtered repositories passed the filter and wait to be cloned
+	Filtered State = "filtered"
+	// Cloned repositories wait to be analysed
+	Cloned State = "cloned"
+	// Analysed repositories have changes waiting to be verified
+	Analysed State = "analysed"
+	// Verified repositories have changes passing the verification, waiting to be reviewed
+	Verified State = "verified"
+	// Pending repositories have changes waiting for approval
+	Pending State = "pending"
+	// Approved repositories have changes waiting to be published
+	Approved State = "approved"
+	// Published repositories are done, their changes were sent upstream
+	Published State = "published"
+	// Recorded repositories are done, their changes were only recorded
+	Recorded State = "recorded"
+	// Skipped repositories are done, their changes were already proposed or fixed upstream
+	Skipped State = "skipped"
+	// Rejected repositories have changes which were not approved
+	Rejected State = "rejected"
+	// Failed repositories are parked after too many failures, or changes not passing the verification
+	Failed State = "failed"
+)
+
+// States are the states of the pipeline, in order.
+var States = []State{Discovered, Filtered, Cloned, Analysed, Verified, Pending, Approved, Published, Recorded, Skipped, Rejected, Failed}
+
+// ErrLocked is returned by Open when the queue is opened by another process.
+var ErrLocked = errors.New("queue opened by another process")
+
+const (
+	// lockFile is the file of the queue directory locked by the process opening it
+	lockFile = "lock"
+
+	defaultMaxAttempts = 5
+	defaultBackoff     = time.Minute
+	defaultMaxBackoff  = time.Hour
+)
+
+// Item is a repository in the queue, with the results of the stages it went through.
+type Item struct {
+	Repo  *github.Repository `json:"repo"`
+	State State              `json:"state"`
+
+	// FailedState is the state in which the item failed, when parked
+	FailedState State `json:"failed_state,omitempty"`
+	// Attempts is the number of failures in the current state
+	Attempts int `json:"attempts"`
+	// NextAttempt is the time before which the item isn't retried
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+
+	DiscoveredAt time.Time `json:"discovered_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// LocalDirectory is the clone of the repository
+	LocalDirectory string `json:"local_directory,omitempty"`
+	// SHA is the commit of the clone
+	SHA string `json:"sha,omitempty"`
+	// Changes are the changes made by the analysis, by file
+	Changes map[string][]codechange.CodeChange `json:"changes,omitempty"`
+	// FileCount is the number of changed files
+	FileCount int `json:"file_count"`
+	// Patch is the patch of the changes, computed before they are applied
+	Patch []byte `json:"patch,omitempty"`
+	// Outcome is the outcome of the verification, and Reason the reason of a failed verification
+	Outcome string `json:"outcome,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	// Steps are the outcomes of the steps of the verification
+	Steps []verify.StepOutcome `json:"steps,omitempty"`
+	// Modes are the publish modes of the checkers having made the changes, by checker
+	Modes map[string]string `json:"modes,omitempty"`
+	// Rejection is the reason why the changes were rejected
+	Rejection string `json:"rejection,omitempty"`
+	// Skip is the reason why the changes were skipped
+	Skip string `json:"skip,omitempty"`
+	// PullRequest is the pull request of the published changes
+	PullRequest *PullRequest `json:"pull_request,omitempty"`
+}
+
+// PullRequest is a pull request opened with the changes of a repository.
+type PullRequest struct {
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+	Branch string `json:"branch"`
+	// State is open, closed or merged
+	State string `json:"state"`
+	// Withdrawn is true when the pull request was closed by the pipeline, e.g. conflicting with upstream changes
+	Withdrawn bool `json:"withdrawn,omitempty"`
+	// OpenedAt is when the pull request was opened, and ClosedAt when it was closed or merged
+	OpenedAt time.Time `json:"opened_at"`
+	ClosedAt time.Time `json:"closed_at"`
+	// Review is the state of the last review approving or requesting changes: approved or changes_requested
+	Review string `json:"review,omitempty"`
+	// Comments are the comments of the maintainers
+	Comments []publisher.Comment `json:"comments,omitempty"`
+	// CheckedAt is when the state of the pull request was last checked
+	CheckedAt time.Time `json:"checked_at"`
+	// Checkers are the checkers whose changes are in the pull request
+	Checkers []string `json:"checkers"`
+}
+
+// Name returns the OWNER/NAME of the repository of the item.
+func (item *Item) Name() string {
+	return item.Repo.GetOwner().GetLogin() + "/" + item.Repo.GetName()
+}
+
+// copy returns a copy of item sharing nothing it may change. The repository, never changed, is shared.
+func (item *Item) copy() *Item {
+	c := *item
+	if item.Changes != nil {
+		c.Changes = make(map[string][]codechange.CodeChange, len(item.Changes))
+		for filename, changes := range item.Changes {
+			c.Changes[filename] = append([]codechange.CodeChange(nil), changes...)
+		}
+	}
+	c.Patch = append([]byte(nil), item.Patch...)
+	c.Steps = append([]verify.StepOutcome(nil), item.Steps...)
+	if item.Modes != nil {
+		c.Modes = make(map[string]string, len(item.Modes))
+		for checker, mode := range item.Modes {
+			c.Modes[checker] = mode
+		}
+	}
+	if item.PullRequest != nil {
+		pr := *item.PullRequest
+		pr.Comments = append([]publisher.Comment(nil), pr.Comments...)
+		pr.Checkers = append([]string(nil), pr.Checkers...)
+		c.PullRequest = &pr
+	}
+	return &c
+}
+
+// Queue is a durable queue of repositories. It's safe for concurrent use.
+type Queue struct {
+	// MaxAttempts is the number of failures after which an item is parked, 5 by default
+	MaxAttempts int
+	// Backoff is the delay before retrying an item after its first failure, doubled on each failure, 1 minute by default
+	Backoff time.Duration
+	// MaxBackoff is the maximum delay before retrying an item, 1 hour by default
+	MaxBackoff time.Duration
+
+	dir  string
+	now  func() time.Time
+	lock *os.File
+
+	mu    sync.Mutex
+	items map[int64]*Item
+	// leased are the items taken by a stage and not advanced, failed or released yet
+	leased map[int64]bool
+	// changed is closed, and replaced, when an item becomes available
+	changed chan struct{}
+}
+
+// Open opens the queue persisted in dir, creating it if needed, and locks it until Close.
+// It returns an error wrapping ErrLocked when the queue is opened by another process.
+// Items leased when the process stopped are available again, in the state they were taken in.
+func Open(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, lockFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lock(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error locking queue %q: %w", dir, err)
+	}
+
+	q := &Queue{
+		MaxAttempts: defaultMaxAttempts,
+		Backoff:     defaultBackoff,
+		MaxBackoff:  defaultMaxBackoff,
+		dir:         dir,
+		now:         time.Now,
+		lock:        f,
+		items:       make(map[int64]*Item),
+		leased:      make(map[int64]bool),
+		changed:     make(chan struct{}),
+	}
+
+	// The queue is locked, the temporary files are leftovers of interrupted writes
+	items, err := readItems(dir, true)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	for _, item := range items {
+		q.items[item.Repo.GetID()] = item
+	}
+
+	return q, nil
+}
+
+// Close releases the lock of the queue, which must not be used anymore.
+func (q *Queue) Close() error {
+	return q.lock.Close()
+}
+
+// Load returns the items of the queue persisted in dir, sorted by discovery, without opening it.
+// The queue may be opened by another process, the items are then a snapshot.
+func Load(dir string) ([]Item, error) {
+	items, err := readItems(dir, false)
+	if os.IsNotExist(err) {
+		// Never opened
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Item
+	for _, item := range items {
+		list = append(list, *item)
+	}
+	sortItems(list)
+
+	return list, nil
+}
+
+// readItems reads the items persisted in dir. Temporary files are removed when clean is true.
+func readItems(dir string, clean bool) ([]*Item, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*Item
+	for _, entry := range entries {
+		filename := filepath.Join(dir, entry.Name())
+		if strings.HasPrefix(entry.Name(), ".") {
+			// Temporary file of a write, interrupted when the queue isn't opened
+			if clean {
+				os.Remove(filename)
+			}
+			continue
+		}
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		item := &Item{}
+		if err := json.Unmarshal(content, item); err != nil {
+			return nil, fmt.Errorf("invalid queue item %q: %v", filename, err)
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// Add adds repo to the queue in the Discovered state. Repositories already queued, whatever their state,
+// are ignored: it returns false.
+func (q *Queue) Add(repo *github.Repository) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.items[repo.GetID()]; ok {
+		return false, nil
+	}
+
+	now := q.now()
+	item := &Item{
+		Repo:         repo,
+		State:        Discovered,
+		DiscoveredAt: now,
+		UpdatedAt:    now,
+	}
+	if err := q.save(item); err != nil {
+		return false, err
+	}
+	q.items[repo.GetID()] = item
+	q.notify()
+
+	return true, nil
+}
+
+// Next takes the next item in state, waiting until one is available or ctx is done.
+// Items are taken in the order of their next attempt, then of their discovery.
+// The item must then be advanced, failed or released.
+func (q *Queue) Next(ctx context.Context, state State) (*Item, error) {
+	for {
+		q.mu.Lock()
+		item, wait := q.ready(state)
+		if item != nil {
+			q.leased[item.Repo.GetID()] = true
+		}
+		changed := q.changed
+		q.mu.Unlock()
+
+		if item != nil {
+			return item, nil
+		}
+
+		var retry <-chan time.Time
+		var timer *time.Timer
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			retry = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-retry:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// ready returns a copy of the next item in state available now, or the time to wait until one
+// is available, 0 when there is none.
+func (q *Queue) ready(state State) (*Item, time.Duration) {
+	now := q.now()
+
+	var next *Item
+	for id, item := range q.items {
+		if item.State != state || q.leased[id] {
+			continue
+		}
+		if next == nil || item.NextAttempt.Before(next.NextAttempt) ||
+			(item.NextAttempt.Equal(next.NextAttempt) && item.DiscoveredAt.Before(next.DiscoveredAt)) {
+			next = item
+		}
+	}
+
+	if next == nil {
+		return nil, 0
+	}
+	if next.NextAttempt.After(now) {
+		return nil, next.NextAttempt.Sub(now)
+	}
+
+	return next.copy(), 0
+}
+
+// Advance moves item, updated by the stage, to state and resets its attempts.
+func (q *Queue) Advance(item *Item, state State) error {
+	item.State = state
+	item.FailedState = ""
+	item.Attempts = 0
+	item.NextAttempt = time.Time{}
+	item.LastError = ""
+
+	return q.update(item)
+}
+
+// Fail records a failure of item. It's retried after a backoff, or parked after MaxAttempts failures.
+func (q *Queue) Fail(item *Item, err error) error {
+	item.Attempts++
+	item.LastError = err.Error()
+	if item.Attempts >= q.MaxAttempts {
+		return q.Park(item, err.Error())
+	}
+
+	backoff := q.Backoff
+	for i := 1; i < item.Attempts && backoff < q.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > q.MaxBackoff {
+		backoff = q.MaxBackoff
+	}
+	item.NextAttempt = q.now().Add(backoff)
+
+	return q.update(item)
+}
+
+// Defer makes item available again at until, in the same state and without counting a failure,
+// e.g. because its changes can't be published before.
+func (q *Queue) Defer(item *Item, until time.Time, reason string) error {
+	item.NextAttempt = until
+	item.LastError = reason
+
+	return q.update(item)
+}
+
+// Park moves item to the Failed state, without retrying it, e.g. because its changes don't pass the verification.
+func (q *Queue) Park(item *Item, reason string) error {
+	if item.State != Failed {
+		item.FailedState = item.State
+	}
+	item.State = Failed
+	item.LastError = reason
+	item.NextAttempt = time.Time{}
+
+	return q.update(item)
+}
+
+// Take leases the item of the repository id when it's in state and not leased, like Next without waiting.
+// It returns a copy of the item, or false when it isn't available.
+func (q *Queue) Take(id int64, state State) (*Item, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, ok := q.items[id]
+	if !ok || item.State != state || q.leased[id] {
+		return nil, false
+	}
+	q.leased[id] = true
+	return item.copy(), true
+}
+
+// Save persists item, updated by the stage, which keeps it leased, e.g. to record progress before going on.
+func (q *Queue) Save(item *Item) error {
+	return q.put(item, false)
+}
+
+// Release makes item available again, unchanged, e.g. because its processing was interrupted.
+func (q *Queue) Release(item *Item) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.leased, item.Repo.GetID())
+	q.notify()
+}
+
+// Remove removes item from the queue, e.g. because it didn't pass the filter.
+func (q *Queue) Remove(item *Item) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	id := item.Repo.GetID()
+	if err := os.Remove(q.filename(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(q.items, id)
+	delete(q.leased, id)
+
+	return nil
+}
+
+// Get returns a copy of the item of the repository OWNER/NAME.
+func (q *Queue) Get(name string) (*Item, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, item := range q.items {
+		if item.Name() == name {
+			return item.copy(), true
+		}
+	}
+	return nil, false
+}
+
+// getIn returns a copy of the item of the repository OWNER/NAME, which must be in state and not leased.
+func (q *Queue) getIn(name string, state State) (*Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for id, item := range q.items {
+		if item.Name() != name {
+			continue
+		}
+		if item.State != state {
+			return nil, fmt.Errorf("repository %q is not %s, it is %s", name, state, item.State)
+		}
+		if q.leased[id] {
+			return nil, fmt.Errorf("repository %q is being processed", name)
+		}
+		return item.copy(), nil
+	}
+	return nil, fmt.Errorf("repository %q is not queued", name)
+}
+
+// Retry moves the parked item of the repository OWNER/NAME back to the state it failed in.
+func (q *Queue) Retry(name string) error {
+	parked, err := q.getIn(name, Failed)
+	if err != nil {
+		return err
+	}
+
+	return q.Advance(parked, parked.FailedState)
+}
+
+// Approve moves the pending item of the repository OWNER/NAME to the Approved state, its changes are published.
+func (q *Queue) Approve(name string) error {
+	pending, err := q.getIn(name, Pending)
+	if err != nil {
+		return err
+	}
+
+	return q.Advance(pending, Approved)
+}
+
+// Reject moves the pending item of the repository OWNER/NAME to the Rejected state, its changes aren't published.
+func (q *Queue) Reject(name, reason string) error {
+	pending, err := q.getIn(name, Pending)
+	if err != nil {
+		return err
+	}
+
+	pending.Rejection = reason
+	return q.Advance(pending, Rejected)
+}
+
+// Items returns a copy of the items, sorted by discovery.
+func (q *Queue) Items() []Item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var items []Item
+	for _, item := range q.items {
+		items = append(items, *item.copy())
+	}
+	sortItems(items)
+
+	return items
+}
+
+// sortItems sorts items by discovery.
+func sortItems(items []Item) {
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].DiscoveredAt.Equal(items[j].DiscoveredAt) {
+			return items[i].DiscoveredAt.Before(items[j].DiscoveredAt)
+		}
+		return items[i].Repo.GetID() < items[j].Repo.GetID()
+	})
+}
+
+// update persists item, releases it and notifies the waiting stages.
+func (q *Queue) update(item *Item) error {
+	return q.put(item, true)
+}
+
+// put persists item, and releases it when release is true.
+func (q *Queue) put(item *Item, release bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	id := item.Repo.GetID()
+	if _, ok := q.items[id]; !ok {
+		return fmt.Errorf("repository %q is not queued", item.Name())
+	}
+
+	item.UpdatedAt = q.now()
+	if err := q.save(item); err != nil {
+		return err
+	}
+
+	q.items[id] = item.copy()
+	if release {
+		delete(q.leased, id)
+		q.notify()
+	}
+
+	return nil
+}
+
+// notify wakes up the stages waiting for an item. q.mu must be held.
+func (q *Queue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+func (q *Queue) filename(id int64) string {
+	return filepath.Join(q.dir, strconv.FormatInt(id, 10)+".json")
+}
+
+// save writes item to its file atomically: a crash leaves either the previous or the new version.
+func (q *Queue) save(item *Item) error {
+	content, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	filename := q.filename(item.Repo.GetID())
+	f, err := ioutil.TempFile(q.dir, "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("error saving queue item %q: %v", item.Name(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/segflow/contribuehub/pkg/codechange"
+	"github.com/segflow/contribuehub/pkg/publisher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func repo(id int64, name string) *github.Repository {
+	return &github.Repository{
+		ID:    github.Int64(id),
+		Owner: &github.User{Login: github.String("owner")},
+		Name:  github.String(name),
+	}
+}
+
+// openQueue opens the queue in dir, using the time pointed by now as clock.
+func openQueue(t *testing.T, dir string, now *time.Time) *Queue {
+	q, err := Open(dir)
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close() })
+	q.now = func() time.Time { return *now }
+	return q
+}
+
+func next(t *testing.T, q *Queue, state State) *Item {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	item, err := q.Next(ctx, state)
+	require.NoError(t, err)
+	return item
+}
+
+func assertEmpty(t *testing.T, q *Queue, state State) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	item, err := q.Next(ctx, state)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, item)
+}
+
+func TestQueueResume(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := openQueue(t, dir, &now)
+
+	for i, name := range []string{"a", "b", "c"} {
+		added, err := q.Add(repo(int64(i+1), name))
+		require.NoError(t, err)
+		assert.True(t, added)
+		now = now.Add(time.Second)
+	}
+	added, err := q.Add(repo(1, "a"))
+	require.NoError(t, err)
+	assert.False(t, added, "repository added twice")
+
+	// Items are taken in discovery order
+	a := next(t, q, Discovered)
+	assert.Equal(t, "owner/a", a.Name())
+	a.LocalDirectory = "/tmp/a"
+	require.NoError(t, q.Advance(a, Cloned))
+
+	b := next(t, q, Discovered)
+	assert.Equal(t, "owner/b", b.Name())
+	require.NoError(t, q.Remove(b))
+
+	// c is leased when the process stops
+	c := next(t, q, Discovered)
+	assert.Equal(t, "owner/c", c.Name())
+	assertEmpty(t, q, Discovered)
+
+	// Leftover of an interrupted write
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".3.json.123"), []byte("{"), 0644))
+
+	// The queue can only be read while it's opened
+	_, err = Open(dir)
+	assert.True(t, errors.Is(err, ErrLocked), "queue opened twice: %v", err)
+	items, err := Load(dir)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "owner/a", items[0].Name())
+	assert.Equal(t, Cloned, items[0].State)
+	assert.Equal(t, "owner/c", items[1].Name())
+	_, err = os.Stat(filepath.Join(dir, ".3.json.123"))
+	assert.NoError(t, err, "temporary file removed by Load")
+
+	require.NoError(t, q.Close())
+	q = openQueue(t, dir, &now)
+	a = next(t, q, Cloned)
+	assert.Equal(t, "owner/a", a.Name())
+	assert.Equal(t, "/tmp/a", a.LocalDirectory)
+	c = next(t, q, Discovered)
+	assert.Equal(t, "owner/c", c.Name())
+
+	var names []string
+	for _, item := range q.Items() {
+		names = append(names, item.Name())
+	}
+	assert.Equal(t, []string{"owner/a", "owner/c"}, names)
+
+	_, err = os.Stat(filepath.Join(dir, ".3.json.123"))
+	assert.True(t, os.IsNotExist(err), "temporary file not removed")
+}
+
+func TestQueueBackoff(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := openQueue(t, t.TempDir(), &now)
+	q.MaxAttempts = 4
+	q.Backoff = time.Minute
+	q.MaxBackoff = 3 * time.Minute
+
+	_, err := q.Add(repo(1, "a"))
+	require.NoError(t, err)
+
+	for _, backoff := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		item := next(t, q, Discovered)
+		require.NoError(t, q.Fail(item, errors.New("clone failed")))
+
+		assertEmpty(t, q, Discovered)
+		now = now.Add(backoff - time.Second)
+		assertEmpty(t, q, Discovered)
+		now = now.Add(time.Second)
+	}
+
+	// Parked after MaxAttempts failures
+	item := next(t, q, Discovered)
+	assert.Equal(t, 3, item.Attempts)
+	require.NoError(t, q.Fail(item, errors.New("clone failed")))
+	assertEmpty(t, q, Discovered)
+
+	items := q.Items()
+	require.Len(t, items, 1)
+	assert.Equal(t, Failed, items[0].State)
+	assert.Equal(t, Discovered, items[0].FailedState)
+	assert.Equal(t, 4, items[0].Attempts)
+	assert.Equal(t, "clone failed", items[0].LastError)
+
+	require.NoError(t, q.Retry("owner/a"))
+	item = next(t, q, Discovered)
+	assert.Equal(t, 0, item.Attempts)
+	assert.Error(t, q.Retry("owner/a"), "retrying an item which isn't parked")
+	assert.Error(t, q.Retry("owner/unknown"))
+}
+
+func TestQueueDefer(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := openQueue(t, t.TempDir(), &now)
+
+	_, err := q.Add(repo(1, "a"))
+	require.NoError(t, err)
+	require.NoError(t, q.Advance(next(t, q, Discovered), Approved))
+
+	item := next(t, q, Approved)
+	require.NoError(t, q.Defer(item, now.Add(24*time.Hour), "backing off"))
+	now = now.Add(24*time.Hour - time.Second)
+	assertEmpty(t, q, Approved)
+	now = now.Add(time.Second)
+
+	item = next(t, q, Approved)
+	assert.Equal(t, 0, item.Attempts)
+	assert.Equal(t, "backing off", item.LastError)
+}
+
+func TestQueueNextWaits(t *testing.T) {
+	now := time.Now()
+	q := openQueue(t, t.TempDir(), &now)
+
+	done := make(chan *Item)
+	go func() {
+		item, _ := q.Next(context.Background(), Filtered)
+		done <- item
+	}()
+
+	_, err := q.Add(repo(1, "a"))
+	require.NoError(t, err)
+	require.NoError(t, q.Advance(next(t, q, Discovered), Filtered))
+
+	var item *Item
+	select {
+	case item = <-done:
+		assert.Equal(t, "owner/a", item.Name())
+	case <-time.After(time.Second):
+		t.Fatal("Next not woken up")
+	}
+
+	// A released item is available again
+	assertEmpty(t, q, Filtered)
+	q.Release(item)
+	assert.Equal(t, "owner/a", next(t, q, Filtered).Name())
+}
+
+func TestQueueReview(t *testing.T) {
+	now := time.Now()
+	q := openQueue(t, t.TempDir(), &now)
+
+	for i, name := range []string{"a", "b"} {
+		_, err := q.Add(repo(int64(i+1), name))
+		require.NoError(t, err)
+		require.NoError(t, q.Advance(next(t, q, Discovered), Pending))
+	}
+
+	assert.EqualError(t, q.Approve("owner/unknown"), `repository "owner/unknown" is not queued`)
+	require.NoError(t, q.Approve("owner/a"))
+	assert.EqualError(t, q.Reject("owner/a", "no"), `repository "owner/a" is not pending, it is approved`)
+	require.NoError(t, q.Reject("owner/b", "not worth it"))
+
+	assert.Equal(t, "owner/a", next(t, q, Approved).Name())
+	b, ok := q.Get("owner/b")
+	require.True(t, ok)
+	assert.Equal(t, Rejected, b.State)
+	assert.Equal(t, "not worth it", b.Rejection)
+
+	_, ok = q.Get("owner/unknown")
+	assert.False(t, ok)
+}
+
+func TestQueueTake(t *testing.T) {
+	now := time.Now()
+	q := openQueue(t, t.TempDir(), &now)
+
+	_, err := q.Add(repo(1, "a"))
+	require.NoError(t, err)
+	require.NoError(t, q.Advance(next(t, q, Discovered), Pending))
+
+	_, ok := q.Take(1, Published)
+	assert.False(t, ok, "item taken in another state")
+	item, ok := q.Take(1, Pending)
+	require.True(t, ok)
+	_, ok = q.Take(1, Pending)
+	assert.False(t, ok, "item taken twice")
+	assert.EqualError(t, q.Approve("owner/a"), `repository "owner/a" is being processed`)
+
+	q.Release(item)
+	require.NoError(t, q.Approve("owner/a"))
+}
+
+func TestQueueCopies(t *testing.T) {
+	now := time.Now()
+	q := openQueue(t, t.TempDir(), &now)
+
+	_, err := q.Add(repo(1, "a"))
+	require.NoError(t, err)
+	item := next(t, q, Discovered)
+	item.Changes = map[string][]codechange.CodeChange{"main.go": {{Offset: 1, Source: "chandir"}}}
+	item.Modes = map[string]string{"chandir": "auto"}
+	item.PullRequest = &PullRequest{Number: 1, Comments: []publisher.Comment{{Body: "Nice"}}, Checkers: []string{"chandir"}}
+	require.NoError(t, q.Advance(item, Published))
+
+	// Changing the item or its copies doesn't change the queue
+	item.PullRequest.Review = "approved"
+	taken, ok := q.Take(1, Published)
+	require.True(t, ok)
+	taken.Changes["main.go"][0].Offset = 2
+	taken.Modes["chandir"] = "review"
+	taken.PullRequest.Comments[0].Body = "Thanks"
+	taken.PullRequest.Checkers[0] = "other"
+	got, _ := q.Get("owner/a")
+	got.PullRequest.State = "merged"
+
+	for _, item := range append(q.Items(), *got) {
+		assert.Equal(t, 1, item.Changes["main.go"][0].Offset)
+		assert.Equal(t, "auto", item.Modes["chandir"])
+		assert.Equal(t, "", item.PullRequest.Review)
+		assert.Equal(t, "Nice", item.PullRequest.Comments[0].Body)
+		assert.Equal(t, []string{"chandir"}, item.PullRequest.Checkers)
+	}
+	assert.Equal(t, "", q.Items()[0].PullRequest.State)
+}
+
+func TestQueueSave(t *testing.T) {
+	now := time.Now()
+	dir := t.TempDir()
+	q := openQueue(t, dir, &now)
+
+	_, err := q.Add(repo(1, "a"))
+	require.NoError(t, err)
+	item := next(t, q, Discovered)
+	item.LastError = "progress"
+	require.NoError(t, q.Save(item))
+
+	// Saved, and still leased
+	assertEmpty(t, q, Discovered)
+	items, err := Load(dir)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "progress", items[0].LastError)
+
+	require.NoError(t, q.Advance(item, Filtered))
+	assert.Equal(t, "owner/a", next(t, q, Filtered).Name())
+}
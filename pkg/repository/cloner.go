@@ -1,11 +1,13 @@
 package repository
 
 import (
+	"context"
 	"fmt"
 	"path"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
 )
 
 type Cloner struct {
@@ -13,7 +15,9 @@ type Cloner struct {
 	Depth    int
 }
 
-func (r *Cloner) Clone(repo *github.Repository) (*Repository, error) {
+// Clone clones repo, or fetches it when already cloned, its working tree being reset to the default branch.
+// The clone is interrupted when ctx is done.
+func (r *Cloner) Clone(ctx context.Context, repo *github.Repository) (*Repository, error) {
 	opts := &git.CloneOptions{
 		URL:      repo.GetCloneURL(),
 		Depth:    r.Depth,
@@ -21,15 +25,17 @@ func (r *Cloner) Clone(repo *github.Repository) (*Repository, error) {
 	}
 
 	dir := path.Join(r.CloneDir, repo.GetOwner().GetLogin(), repo.GetName())
-	gitRepo, err := git.PlainClone(dir, false, opts)
+	gitRepo, err := git.PlainCloneContext(ctx, dir, false, opts)
 	if err != nil && err != git.ErrRepositoryAlreadyExists {
 		return nil, err
 	}
 
 	if err == git.ErrRepositoryAlreadyExists {
-		if gitRepo, err := git.PlainOpen(dir); err == nil {
-			gitRepo.Fetch(&git.FetchOptions{Depth: 1})
-		} else {
+		gitRepo, err = git.PlainOpen(dir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot fetch repository %s/%s: %v", repo.GetOwner().GetLogin(), repo.GetName(), err)
+		}
+		if err := fetch(ctx, gitRepo, repo, r.Depth); err != nil {
 			return nil, fmt.Errorf("cannot fetch repository %s/%s: %v", repo.GetOwner().GetLogin(), repo.GetName(), err)
 		}
 	}
@@ -40,3 +46,32 @@ func (r *Cloner) Clone(repo *github.Repository) (*Repository, error) {
 		LocalDirectory: dir,
 	}, nil
 }
+
+// fetch fetches the clone gitRepo of repo, and hard resets it to the fetched default branch: the changes made
+// to the clone are discarded.
+func fetch(ctx context.Context, gitRepo *git.Repository, repo *github.Repository, depth int) error {
+	err := gitRepo.FetchContext(ctx, &git.FetchOptions{Depth: depth, Force: true})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	branch := repo.GetDefaultBranch()
+	if branch == "" {
+		// The branch checked out by the clone is the default one
+		head, err := gitRepo.Head()
+		if err != nil {
+			return err
+		}
+		branch = head.Name().Short()
+	}
+	remote, err := gitRepo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch), true)
+	if err != nil {
+		return fmt.Errorf("cannot find default branch %s: %v", branch, err)
+	}
+
+	w, err := gitRepo.Worktree()
+	if err != nil {
+		return err
+	}
+	return w.Reset(&git.ResetOptions{Commit: remote.Hash(), Mode: git.HardReset})
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// commitFile commits content as a.go in the repository dir, and returns the commit.
+func commitFile(t *testing.T, dir, content string) string {
+	gitRepo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+	w, err := gitRepo.Worktree()
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte(content), 0644))
+	_, err = w.Add("a.go")
+	require.NoError(t, err)
+	hash, err := w.Commit(content, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+	return hash.String()
+}
+
+func TestClonerClone(t *testing.T) {
+	upstream := t.TempDir()
+	_, err := git.PlainInit(upstream, false)
+	require.NoError(t, err)
+	commitFile(t, upstream, "package a\n")
+
+	cloner := &Cloner{CloneDir: t.TempDir(), Depth: 1}
+	repo := &github.Repository{
+		Owner:    &github.User{Login: github.String("owner")},
+		Name:     github.String("name"),
+		CloneURL: github.String(upstream),
+	}
+	clone, err := cloner.Clone(context.Background(), repo)
+	require.NoError(t, err)
+	filename := filepath.Join(clone.LocalDirectory, "a.go")
+
+	// Cloning again fetches the new commits and discards the changes
+	head := commitFile(t, upstream, "package a\n\nfunc A() {}\n")
+	require.NoError(t, ioutil.WriteFile(filename, []byte("package b\n"), 0644))
+	clone, err = cloner.Clone(context.Background(), repo)
+	require.NoError(t, err)
+	sha, err := clone.Head()
+	require.NoError(t, err)
+	assert.Equal(t, head, sha)
+	content, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "package a\n\nfunc A() {}\n", string(content))
+
+	// Up to date
+	_, err = cloner.Clone(context.Background(), repo)
+	assert.NoError(t, err)
+}
@@ -1,10 +1,13 @@
 package repository
 
 import (
+	"context"
+
 	"github.com/google/go-github/github"
 )
 
-// Discoverer is the interface all repo discoverer should implement
+// Discoverer is the interface all repo discoverer should implement.
+// Discover sends repositories on the returned channel until ctx is done, then closes it.
 type Discoverer interface {
-	Discover() chan *github.Repository
+	Discover(ctx context.Context) chan *github.Repository
 }
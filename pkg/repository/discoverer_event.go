@@ -3,19 +3,30 @@ package repository
 import (
 	"context"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/github"
-	"github.com/sirupsen/logrus"
+	"github.com/segflow/contribuehub/pkg/log"
+	"github.com/segflow/contribuehub/pkg/metrics"
 )
 
 const (
-	eventPerPage   = 300
-	discoverPeriod = 30 * time.Second
-	goroutines     = 8
+	defaultEventPerPage   = 100
+	defaultDiscoverPeriod = 30 * time.Second
+	defaultWorkers        = 8
 )
 
+var _ Discoverer = (*EventDiscoverer)(nil)
+
 type EventDiscoverer struct {
+	// Period is the time waited between two event listings
+	Period time.Duration
+	// PerPage is the number of events of each page, at most 100
+	PerPage int
+	// Workers is the number of repositories fetched concurrently
+	Workers int
+
 	client    *github.Client
 	seenRepos map[int64]bool
 	lastETAG  string
@@ -23,6 +34,9 @@ type EventDiscoverer struct {
 
 func NewEventDiscoverer(c *github.Client) *EventDiscoverer {
 	return &EventDiscoverer{
+		Period:    defaultDiscoverPeriod,
+		PerPage:   defaultEventPerPage,
+		Workers:   defaultWorkers,
 		client:    c,
 		seenRepos: make(map[int64]bool),
 	}
@@ -30,13 +44,14 @@ func NewEventDiscoverer(c *github.Client) *EventDiscoverer {
 
 func (e *EventDiscoverer) getNewEvents(ctx context.Context) ([]*github.Event, error) {
 	var events []*github.Event
-	opt := &github.ListOptions{PerPage: eventPerPage}
+	opt := &github.ListOptions{PerPage: e.PerPage}
 
 	for {
 		evs, resp, err := e.client.Activity.ListEvents(ctx, opt)
 		if err != nil {
 			return nil, err
 		}
+		metrics.EventsFetched.Add(float64(len(evs)))
 		events = append(events, evs...)
 		if resp.NextPage == 0 {
 			break
@@ -48,27 +63,42 @@ func (e *EventDiscoverer) getNewEvents(ctx context.Context) ([]*github.Event, er
 	return events, nil
 }
 
+// Discover sends the repositories of new events on the returned channel, until ctx is done.
+// The channel is closed once the discovery stopped, no repository is sent after that.
 func (e *EventDiscoverer) Discover(ctx context.Context) chan *github.Repository {
 	ch := make(chan *github.Repository)
 	go func() {
+		defer close(ch)
 		e.discoverLoop(ctx, ch)
 	}()
 	return ch
 }
 
 func (e *EventDiscoverer) discoverLoop(ctx context.Context, ch chan<- *github.Repository) {
+	ctx = log.WithField(ctx, log.FieldStage, "discover")
+	logger := log.FromContext(ctx)
 	for {
-		logrus.Info("Discovering new repositories.")
+		logger.Info("Discovering new repositories.")
 		err := e.discover(ctx, ch)
 		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
-			logrus.Infof("Stopping event based discoverer: %s", err)
+			logger.Infof("Stopping event based discoverer: %s", err)
 			return
 		}
+		if err != nil {
+			logger.Warnf("Error listing events: %s", err)
+		}
 
-		time.Sleep(discoverPeriod)
+		select {
+		case <-ctx.Done():
+			logger.Infof("Stopping event based discoverer: %s", ctx.Err())
+			return
+		case <-time.After(e.Period):
+		}
 	}
 }
 
+// discover sends the repositories of the events not seen yet on ch.
+// It returns once all of them were sent, or ctx is done, and never sends on ch after returning.
 func (e *EventDiscoverer) discover(ctx context.Context, ch chan<- *github.Repository) error {
 	events, err := e.getNewEvents(ctx)
 	if err != nil {
@@ -76,12 +106,15 @@ func (e *EventDiscoverer) discover(ctx context.Context, ch chan<- *github.Reposi
 	}
 
 	eventsCh := make(chan *github.Event)
-	for i := 0; i < goroutines; i++ {
+	var wg sync.WaitGroup
+	for i := 0; i < e.Workers; i++ {
+		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			for event := range eventsCh {
 				repo, _, err := e.client.Repositories.GetByID(ctx, event.GetRepo().GetID())
 				if err != nil {
-					// logrus.Warnf("Error getting repository %q: %s", event.GetRepo().GetName(), err)
+					log.FromContext(ctx).WithField(log.FieldRepo, event.GetRepo().GetName()).Debugf("Error getting repository: %s", err)
 					continue
 				}
 
@@ -94,6 +127,9 @@ func (e *EventDiscoverer) discover(ctx context.Context, ch chan<- *github.Reposi
 		}()
 	}
 
+	defer wg.Wait()
+	defer close(eventsCh)
+
 	for _, event := range events {
 
 		if e.seenRepos[event.GetRepo().GetID()] {
@@ -104,7 +140,6 @@ func (e *EventDiscoverer) discover(ctx context.Context, ch chan<- *github.Reposi
 		select {
 		case eventsCh <- event:
 		case <-ctx.Done():
-			close(ch)
 			return ctx.Err()
 		}
 	}
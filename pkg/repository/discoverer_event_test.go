@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventDiscovererDiscover(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		// Repository 2 appears twice, it's only sent once
+		fmt.Fprint(w, `[{"repo": {"id": 1}}, {"repo": {"id": 2}}, {"repo": {"id": 2}}, {"repo": {"id": 3}}]`)
+	})
+	mux.HandleFunc("/repositories/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/repositories/")
+		fmt.Fprintf(w, `{"id": %s, "name": "repo%s"}`, id, id)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	discoverer := NewEventDiscoverer(client)
+	discoverer.Period = time.Millisecond
+	discoverer.Workers = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := discoverer.Discover(ctx)
+
+	var names []string
+	for len(names) < 3 {
+		select {
+		case repo := <-ch:
+			names = append(names, repo.GetName())
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout waiting for repositories")
+		}
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"repo1", "repo2", "repo3"}, names)
+
+	// Events already seen aren't sent again, the channel is closed once stopped
+	cancel()
+	select {
+	case repo, ok := <-ch:
+		require.False(t, ok, "unexpected repository %q", repo.GetName())
+	case <-time.After(10 * time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+}
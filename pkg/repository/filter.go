@@ -2,6 +2,7 @@ package repository
 
 import (
 	"fmt"
+	"path"
 
 	"github.com/google/go-github/github"
 )
@@ -9,13 +10,17 @@ import (
 type Filter struct {
 	IncludeFork bool
 	Languages   map[string]bool
-	Ignore      map[string]bool
+	MinStars    int
+	// Ignore are the OWNER/NAME patterns, as matched by path.Match, of the ignored repositories
+	Ignore []string
 }
 
 func (f *Filter) Check(repo *github.Repository) bool {
 	name := fmt.Sprintf("%s/%s", repo.GetOwner().GetLogin(), repo.GetName())
-	if f.Ignore[name] {
-		return true
+	for _, pattern := range f.Ignore {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
 	}
 
 	if !f.IncludeFork && repo.GetFork() {
@@ -26,6 +31,10 @@ func (f *Filter) Check(repo *github.Repository) bool {
 		return false
 	}
 
+	if repo.GetStargazersCount() < f.MinStars {
+		return false
+	}
+
 	return true
 }
 
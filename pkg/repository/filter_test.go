@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterCheck(t *testing.T) {
+	repo := func(owner, name, language string, fork bool, stars int) *github.Repository {
+		return &github.Repository{
+			Owner:           &github.User{Login: github.String(owner)},
+			Name:            github.String(name),
+			Language:        github.String(language),
+			Fork:            github.Bool(fork),
+			StargazersCount: github.Int(stars),
+		}
+	}
+
+	filter := &Filter{
+		Languages: map[string]bool{"Go": true},
+		MinStars:  5,
+		Ignore:    []string{"kubernetes/kubernetes", "golang/*"},
+	}
+
+	tt := map[string]struct {
+		Repo     *github.Repository
+		Expected bool
+	}{
+		"kept":          {Repo: repo("segflow", "contributehub", "Go", false, 10), Expected: true},
+		"ignored":       {Repo: repo("kubernetes", "kubernetes", "Go", false, 10), Expected: false},
+		"ignored-owner": {Repo: repo("golang", "tools", "Go", false, 10), Expected: false},
+		"fork":          {Repo: repo("segflow", "tools", "Go", true, 10), Expected: false},
+		"language":      {Repo: repo("segflow", "site", "Rust", false, 10), Expected: false},
+		"stars":         {Repo: repo("segflow", "new", "Go", false, 4), Expected: false},
+	}
+
+	for name, tc := range tt {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.Expected, filter.Check(tc.Repo))
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package repository
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-git.v4"
 )
@@ -10,3 +14,53 @@ type Repository struct {
 	*github.Repository
 	LocalDirectory string
 }
+
+// Open opens the clone of repo in dir.
+func Open(dir string, repo *github.Repository) (*Repository, error) {
+	gitRepo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open clone of %s/%s: %v", repo.GetOwner().GetLogin(), repo.GetName(), err)
+	}
+
+	return &Repository{
+		git:            gitRepo,
+		Repository:     repo,
+		LocalDirectory: dir,
+	}, nil
+}
+
+// Size returns the size on disk of the clone, in bytes.
+func (r *Repository) Size() (int64, error) {
+	var size int64
+	err := filepath.Walk(r.LocalDirectory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
+
+// Head returns the hash of the commit checked out in the clone.
+func (r *Repository) Head() (string, error) {
+	ref, err := r.git.Head()
+	if err != nil {
+		return "", err
+	}
+
+	return ref.Hash().String(), nil
+}
+
+// Reset discards the changes made to the working tree of the repository.
+func (r *Repository) Reset() error {
+	w, err := r.git.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return w.Reset(&git.ResetOptions{Mode: git.HardReset})
+}
@@ -0,0 +1,269 @@
+// Package sarif exports code changes as a SARIF 2.1.0 log, for code scanning dashboards and IDEs.
+//
+// The log has a single run. Each checker is a rule whose id is the checker name, each change is a
+// result with its location and a fix. File URIs are relative to the SRCROOT base id, the directory checked.
+package sarif
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/segflow/contribuehub/pkg/codechange"
+)
+
+const (
+	// Version is the version of SARIF
+	Version = "2.1.0"
+	// Schema is the JSON schema of SARIF logs
+	Schema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+	toolName = "contributehub"
+	toolURI  = "https://github.com/segflow/contribuehub"
+
+	// srcRoot is the base id of files URIs
+	srcRoot = "SRCROOT"
+)
+
+// Log is a SARIF log.
+type Log struct {
+	Schema  string `json:"$schema"`
+	Version string `json:"version"`
+	Runs    []Run  `json:"runs"`
+}
+
+// Run is the result of a single run of the tool.
+type Run struct {
+	Tool               Tool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]ArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	ColumnKind         string                      `json:"columnKind"`
+	Results            []Result                    `json:"results"`
+}
+
+// Tool describes the tool and its rules.
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+// Driver is the component of the tool running the rules.
+type Driver struct {
+	Name           string                `json:"name"`
+	InformationURI string                `json:"informationUri,omitempty"`
+	Rules          []ReportingDescriptor `json:"rules"`
+}
+
+// ReportingDescriptor is the metadata of a rule.
+type ReportingDescriptor struct {
+	ID                   string        `json:"id"`
+	ShortDescription     Message       `json:"shortDescription"`
+	DefaultConfiguration Configuration `json:"defaultConfiguration"`
+}
+
+// Configuration is the configuration of a rule.
+type Configuration struct {
+	Level string `json:"level"`
+}
+
+// Message is a plain text message.
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Result is a change reported by a rule.
+type Result struct {
+	RuleID    string     `json:"ruleId"`
+	RuleIndex int        `json:"ruleIndex"`
+	Level     string     `json:"level"`
+	Message   Message    `json:"message"`
+	Locations []Location `json:"locations"`
+	Fixes     []Fix      `json:"fixes"`
+}
+
+// Location is the location of a result.
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+// PhysicalLocation is a region of a file.
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           Region           `json:"region"`
+}
+
+// ArtifactLocation is the location of a file, relative to URIBaseID when set.
+type ArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+// Region is a range of characters of a file. Lines and columns start at 1, offsets at 0.
+type Region struct {
+	StartLine   int `json:"startLine,omitempty"`
+	StartColumn int `json:"startColumn,omitempty"`
+	CharOffset  int `json:"charOffset"`
+	CharLength  int `json:"charLength"`
+}
+
+// Fix is a set of changes fixing a result.
+type Fix struct {
+	Description     Message          `json:"description"`
+	ArtifactChanges []ArtifactChange `json:"artifactChanges"`
+}
+
+// ArtifactChange is a set of replacements in a file.
+type ArtifactChange struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Replacements     []Replacement    `json:"replacements"`
+}
+
+// Replacement replaces a region of a file. Insertions have an empty deleted region.
+type Replacement struct {
+	DeletedRegion   Region   `json:"deletedRegion"`
+	InsertedContent *Content `json:"insertedContent,omitempty"`
+}
+
+// Content is the text of an artifact.
+type Content struct {
+	Text string `json:"text"`
+}
+
+// Rule describes a checker.
+type Rule struct {
+	ID          string
+	Description string
+}
+
+// NewLog returns the log of the changes made by the rules to the files in root.
+// The files are read to compute the characters offsets, SARIF counting characters rather than bytes.
+func NewLog(root string, rules []Rule, changes map[string][]codechange.CodeChange) (*Log, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	run := Run{
+		Tool: Tool{Driver: Driver{
+			Name:           toolName,
+			InformationURI: toolURI,
+			Rules:          []ReportingDescriptor{},
+		}},
+		OriginalURIBaseIDs: map[string]ArtifactLocation{
+			srcRoot: {URI: (&url.URL{Scheme: "file", Path: filepath.ToSlash(root) + "/"}).String()},
+		},
+		ColumnKind: "unicodeCodePoints",
+		Results:    []Result{},
+	}
+
+	ruleIndex := make(map[string]int)
+	for i, rule := range rules {
+		ruleIndex[rule.ID] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, ReportingDescriptor{
+			ID:                   rule.ID,
+			ShortDescription:     Message{Text: rule.Description},
+			DefaultConfiguration: Configuration{Level: "note"},
+		})
+	}
+
+	var filenames []string
+	for filename := range changes {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil {
+			return nil, fmt.Errorf("file %q is not in %q: %v", filename, root, err)
+		}
+		artifact := ArtifactLocation{URI: filepath.ToSlash(rel), URIBaseID: srcRoot}
+
+		for _, change := range changes[filename] {
+			index, ok := ruleIndex[change.Source]
+			if !ok {
+				return nil, fmt.Errorf("change of unknown rule %q: %s", change.Source, change)
+			}
+
+			region, err := charRegion(content, change)
+			if err != nil {
+				return nil, err
+			}
+
+			replacement := Replacement{DeletedRegion: Region{CharOffset: region.CharOffset, CharLength: region.CharLength}}
+			if len(change.Add) != 0 {
+				replacement.InsertedContent = &Content{Text: string(change.Add)}
+			}
+
+			message := change.Message
+			if message == "" {
+				message = change.String()
+			}
+
+			run.Results = append(run.Results, Result{
+				RuleID:    change.Source,
+				RuleIndex: index,
+				Level:     "note",
+				Message:   Message{Text: message},
+				Locations: []Location{{PhysicalLocation: PhysicalLocation{ArtifactLocation: artifact, Region: region}}},
+				Fixes: []Fix{{
+					Description: Message{Text: message},
+					ArtifactChanges: []ArtifactChange{{
+						ArtifactLocation: artifact,
+						Replacements:     []Replacement{replacement},
+					}},
+				}},
+			})
+		}
+	}
+
+	return &Log{
+		Schema:  Schema,
+		Version: Version,
+		Runs:    []Run{run},
+	}, nil
+}
+
+// charRegion returns the region of content changed by change, counting characters instead of bytes.
+func charRegion(content []byte, change codechange.CodeChange) (Region, error) {
+	if change.Offset < 0 || change.Delete < 0 || change.Offset+change.Delete > len(content) {
+		return Region{}, fmt.Errorf("change out of range of %q (%d bytes): %s", change.Filename, len(content), change)
+	}
+
+	before := content[:change.Offset]
+	line := 1
+	lineStart := 0
+	for i, b := range before {
+		if b == '\n' {
+			line++
+			lineStart = i + 1
+		}
+	}
+
+	return Region{
+		StartLine:   line,
+		StartColumn: utf8.RuneCount(before[lineStart:]) + 1,
+		CharOffset:  utf8.RuneCount(before),
+		CharLength:  utf8.RuneCount(content[change.Offset : change.Offset+change.Delete]),
+	}, nil
+}
+
+// Write writes log as indented JSON to w.
+func (log *Log) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(log)
+}
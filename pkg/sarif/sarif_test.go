@@ -0,0 +1,90 @@
+package sarif
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/segflow/contribuehub/pkg/codechange"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sarif")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Non ASCII characters are counted as one character
+	content := "package p\n\n// é\nfunc f(ch chan int) { ch <- 1 }\n\nfunc g(jobs Jobs) {}\n"
+	filename := filepath.Join(dir, "p", "a.go")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+	assert.NoError(t, ioutil.WriteFile(filename, []byte(content), 0644))
+
+	rules := []Rule{{ID: "other", Description: "Other"}, {ID: "chandir", Description: "Narrows channels"}}
+	changes := map[string][]codechange.CodeChange{
+		filename: {
+			{Filename: filename, Offset: 31, Add: []byte("<-"), Source: "chandir", Message: "ch can be chan<- int"},
+			{Filename: filename, Offset: 62, Delete: 4, Add: []byte("<-chan Job"), Source: "chandir"},
+		},
+	}
+
+	log, err := NewLog(dir, rules, changes)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, Version, log.Version)
+	if !assert.Len(t, log.Runs, 1) {
+		return
+	}
+	run := log.Runs[0]
+	assert.Len(t, run.Tool.Driver.Rules, 2)
+	assert.Equal(t, "file://"+filepath.ToSlash(dir)+"/", run.OriginalURIBaseIDs[srcRoot].URI)
+	if !assert.Len(t, run.Results, 2) {
+		return
+	}
+
+	insert := run.Results[0]
+	assert.Equal(t, "chandir", insert.RuleID)
+	assert.Equal(t, 1, insert.RuleIndex)
+	assert.Equal(t, "ch can be chan<- int", insert.Message.Text)
+	location := insert.Locations[0].PhysicalLocation
+	assert.Equal(t, ArtifactLocation{URI: "p/a.go", URIBaseID: srcRoot}, location.ArtifactLocation)
+	assert.Equal(t, Region{StartLine: 4, StartColumn: 15, CharOffset: 30, CharLength: 0}, location.Region)
+	replacement := insert.Fixes[0].ArtifactChanges[0].Replacements[0]
+	assert.Equal(t, Region{CharOffset: 30}, replacement.DeletedRegion)
+	assert.Equal(t, "<-", replacement.InsertedContent.Text)
+
+	replace := run.Results[1]
+	assert.NotEmpty(t, replace.Message.Text)
+	assert.Equal(t, Region{StartLine: 6, StartColumn: 13, CharOffset: 61, CharLength: 4}, replace.Locations[0].PhysicalLocation.Region)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, log.Write(buf))
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, Schema, decoded["$schema"])
+	assert.Contains(t, buf.String(), `"text": "<-"`)
+}
+
+func TestNewLogUnknownRule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sarif")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "a.go")
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("package p\n"), 0644))
+
+	changes := map[string][]codechange.CodeChange{
+		filename: {{Filename: filename, Offset: 0, Add: []byte("x"), Source: "unknown"}},
+	}
+	_, err = NewLog(dir, nil, changes)
+	assert.Error(t, err)
+}
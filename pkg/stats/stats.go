@@ -0,0 +1,175 @@
+// Package stats computes the acceptance of the pull requests opened by the pipeline, by checker, repository size
+// and owner, to tell which checkers are worth running.
+package stats
+
+import (
+	"sort"
+
+	"github.com/segflow/contribuehub/pkg/publisher"
+	"github.com/segflow/contribuehub/pkg/queue"
+)
+
+// sizeBands are the upper bounds, in KB as the size of the GitHub repositories, and names of the size bands.
+var sizeBands = []struct {
+	max  int
+	name string
+}{
+	{1 << 10, "< 1 MB"},
+	{10 << 10, "1-10 MB"},
+	{100 << 10, "10-100 MB"},
+	{-1, ">= 100 MB"},
+}
+
+// SizeBand returns the name of the size band of a repository of size KB.
+func SizeBand(size int) string {
+	for _, band := range sizeBands {
+		if band.max < 0 || size < band.max {
+			return band.name
+		}
+	}
+	return ""
+}
+
+// Acceptance counts the outcomes of pull requests.
+type Acceptance struct {
+	// Key is the checker, size band or owner of the pull requests
+	Key    string `json:"key"`
+	Opened int    `json:"opened"`
+	Open   int    `json:"open"`
+	Merged int    `json:"merged"`
+	// Closed are the pull requests closed without being merged by the maintainers
+	Closed int `json:"closed"`
+	// Withdrawn are the pull requests closed by the pipeline
+	Withdrawn int `json:"withdrawn"`
+	// Commented are the pull requests with comments of the maintainers
+	Commented int `json:"commented"`
+	// ChangesRequested are the pull requests whose last review requested changes
+	ChangesRequested int `json:"changes_requested"`
+}
+
+// Rate returns the share of the pull requests merged among those merged or closed by the maintainers,
+// 0 when there is none.
+func (a *Acceptance) Rate() float64 {
+	if a.Merged+a.Closed == 0 {
+		return 0
+	}
+	return float64(a.Merged) / float64(a.Merged+a.Closed)
+}
+
+func (a *Acceptance) add(pr *queue.PullRequest) {
+	a.Opened++
+	switch {
+	case pr.State == "merged":
+		a.Merged++
+	case pr.State == "closed" && pr.Withdrawn:
+		a.Withdrawn++
+	case pr.State == "closed":
+		a.Closed++
+	default:
+		a.Open++
+	}
+	if len(pr.Comments) > 0 {
+		a.Commented++
+	}
+	if pr.Review == "changes_requested" {
+		a.ChangesRequested++
+	}
+}
+
+// Stats are the acceptance of the pull requests, overall and by group.
+type Stats struct {
+	Total Acceptance `json:"total"`
+	// Checkers are sorted by name, a pull request counts for each of its checkers
+	Checkers []*Acceptance `json:"checkers"`
+	// SizeBands are sorted by size
+	SizeBands []*Acceptance `json:"size_bands"`
+	// Owners are sorted by opened pull requests, most first
+	Owners []*Acceptance `json:"owners"`
+}
+
+// Compute returns the Stats of the pull requests of items.
+func Compute(items []queue.Item) *Stats {
+	s := &Stats{Total: Acceptance{Key: "total"}}
+	checkers := make(map[string]*Acceptance)
+	bands := make(map[string]*Acceptance)
+	owners := make(map[string]*Acceptance)
+
+	group := func(groups map[string]*Acceptance, key string) *Acceptance {
+		a, ok := groups[key]
+		if !ok {
+			a = &Acceptance{Key: key}
+			groups[key] = a
+		}
+		return a
+	}
+
+	for i := range items {
+		pr := items[i].PullRequest
+		if pr == nil {
+			continue
+		}
+
+		s.Total.add(pr)
+		for _, checker := range pr.Checkers {
+			group(checkers, checker).add(pr)
+		}
+		group(bands, SizeBand(items[i].Repo.GetSize())).add(pr)
+		group(owners, items[i].Repo.GetOwner().GetLogin()).add(pr)
+	}
+
+	for _, a := range checkers {
+		s.Checkers = append(s.Checkers, a)
+	}
+	sort.Slice(s.Checkers, func(i, j int) bool { return s.Checkers[i].Key < s.Checkers[j].Key })
+
+	for _, band := range sizeBands {
+		if a, ok := bands[band.name]; ok {
+			s.SizeBands = append(s.SizeBands, a)
+		}
+	}
+
+	for _, a := range owners {
+		s.Owners = append(s.Owners, a)
+	}
+	sort.Slice(s.Owners, func(i, j int) bool {
+		if s.Owners[i].Opened != s.Owners[j].Opened {
+			return s.Owners[i].Opened > s.Owners[j].Opened
+		}
+		return s.Owners[i].Key < s.Owners[j].Key
+	})
+
+	return s
+}
+
+// Comment is a comment of a maintainer on a pull request, with its repository and checkers, for triage.
+type Comment struct {
+	// Repo is the OWNER/NAME of the repository
+	Repo string `json:"repo"`
+	// PullRequest is the URL of the pull request, and PullRequestState its state
+	PullRequest      string   `json:"pull_request"`
+	PullRequestState string   `json:"pull_request_state"`
+	Checkers         []string `json:"checkers"`
+	publisher.Comment
+}
+
+// Comments returns the comments of the maintainers on the pull requests of items, by pull request.
+func Comments(items []queue.Item) []Comment {
+	var comments []Comment
+	for i := range items {
+		pr := items[i].PullRequest
+		if pr == nil {
+			continue
+		}
+		for _, c := range pr.Comments {
+			comments = append(comments, Comment{
+				Repo:             items[i].Name(),
+				PullRequest:      pr.URL,
+				PullRequestState: pr.State,
+				Checkers:         pr.Checkers,
+				Comment:          c,
+			})
+		}
+	}
+
+	return comments
+}
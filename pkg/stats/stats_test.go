@@ -0,0 +1,80 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/segflow/contribuehub/pkg/publisher"
+	"github.com/segflow/contribuehub/pkg/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func item(owner string, size int, pr *queue.PullRequest) queue.Item {
+	return queue.Item{
+		Repo: &github.Repository{
+			Owner: &github.User{Login: github.String(owner)},
+			Name:  github.String("name"),
+			Size:  github.Int(size),
+		},
+		PullRequest: pr,
+	}
+}
+
+func TestSizeBand(t *testing.T) {
+	assert.Equal(t, "< 1 MB", SizeBand(0))
+	assert.Equal(t, "1-10 MB", SizeBand(1024))
+	assert.Equal(t, "10-100 MB", SizeBand(50*1024))
+	assert.Equal(t, ">= 100 MB", SizeBand(100*1024))
+}
+
+func TestCompute(t *testing.T) {
+	comment := []publisher.Comment{{Author: "alice", Body: "Thanks"}}
+	items := []queue.Item{
+		item("a", 10, &queue.PullRequest{State: "merged", Checkers: []string{"chandir"}, Comments: comment}),
+		item("a", 10, &queue.PullRequest{State: "closed", Checkers: []string{"chandir", "other"}, Review: "changes_requested"}),
+		item("b", 5000, &queue.PullRequest{State: "open", Checkers: []string{"other"}}),
+		item("c", 5000, &queue.PullRequest{State: "closed", Withdrawn: true, Checkers: []string{"chandir"}}),
+		// Not published
+		item("d", 10, nil),
+	}
+
+	s := Compute(items)
+	assert.Equal(t, Acceptance{Key: "total", Opened: 4, Open: 1, Merged: 1, Closed: 1, Withdrawn: 1, Commented: 1, ChangesRequested: 1}, s.Total)
+	assert.Equal(t, 0.5, s.Total.Rate())
+
+	require.Len(t, s.Checkers, 2)
+	assert.Equal(t, &Acceptance{Key: "chandir", Opened: 3, Merged: 1, Closed: 1, Withdrawn: 1, Commented: 1, ChangesRequested: 1}, s.Checkers[0])
+	assert.Equal(t, &Acceptance{Key: "other", Opened: 2, Open: 1, Closed: 1, ChangesRequested: 1}, s.Checkers[1])
+	assert.Equal(t, 0.0, s.Checkers[1].Rate())
+
+	require.Len(t, s.SizeBands, 2)
+	assert.Equal(t, "< 1 MB", s.SizeBands[0].Key)
+	assert.Equal(t, 2, s.SizeBands[0].Opened)
+	assert.Equal(t, "1-10 MB", s.SizeBands[1].Key)
+
+	var owners []string
+	for _, a := range s.Owners {
+		owners = append(owners, a.Key)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, owners)
+}
+
+func TestComments(t *testing.T) {
+	items := []queue.Item{
+		item("a", 10, &queue.PullRequest{
+			URL:      "https://github.com/a/name/pull/1",
+			State:    "open",
+			Checkers: []string{"chandir"},
+			Comments: []publisher.Comment{{Author: "alice", Kind: "review", State: "changes_requested", Body: "No"}},
+		}),
+		item("b", 10, &queue.PullRequest{State: "open"}),
+	}
+
+	comments := Comments(items)
+	require.Len(t, comments, 1)
+	assert.Equal(t, "a/name", comments[0].Repo)
+	assert.Equal(t, "https://github.com/a/name/pull/1", comments[0].PullRequest)
+	assert.Equal(t, "changes_requested", comments[0].State)
+	assert.Equal(t, "No", comments[0].Body)
+}
@@ -0,0 +1,101 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Outcome is the conclusion of the verification of changes.
+type Outcome string
+
+const (
+	// Passed changes don't break the build, vet or tests.
+	Passed Outcome = "passed"
+	// Broken changes make the build, vet or tests fail.
+	Broken Outcome = "broken"
+	// Unverifiable changes cannot be proved safe, e.g. because the module didn't build before the changes.
+	Unverifiable Outcome = "unverifiable"
+)
+
+// Verification compares the reports of a module before and after the changes.
+type Verification struct {
+	Outcome Outcome
+	Reason  string
+	Before  *Report
+	After   *Report
+}
+
+// Compare returns the verification of changes from the reports of the module before and after the changes.
+//
+// Build and vet must pass before and after the changes. Tests failing before the changes are tolerated,
+// as long as no other package fails after the changes.
+func Compare(before, after *Report) *Verification {
+	v := &Verification{
+		Outcome: Passed,
+		Before:  before,
+		After:   after,
+	}
+
+	for _, name := range []string{StepBuild, StepVet} {
+		b, a := before.Step(name), after.Step(name)
+		switch {
+		case b == nil || !b.Passed:
+			v.Outcome, v.Reason = Unverifiable, fmt.Sprintf("go %s fails before the changes", name)
+		case a == nil || !a.Passed:
+			v.Outcome, v.Reason = Broken, fmt.Sprintf("go %s fails after the changes", name)
+		default:
+			continue
+		}
+		return v
+	}
+
+	b, a := before.Step(StepTest), after.Step(StepTest)
+	if b == nil || a == nil {
+		return v
+	}
+
+	switch {
+	case b.TimedOut:
+		v.Outcome, v.Reason = Unverifiable, "go test timed out before the changes"
+	case a.TimedOut:
+		v.Outcome, v.Reason = Broken, "go test timed out after the changes"
+	case !a.Passed:
+		failed := make(map[string]bool)
+		for _, pkg := range b.FailedPackages {
+			failed[pkg] = true
+		}
+
+		var newlyFailed []string
+		for _, pkg := range a.FailedPackages {
+			if !failed[pkg] {
+				newlyFailed = append(newlyFailed, pkg)
+			}
+		}
+
+		switch {
+		case len(newlyFailed) != 0:
+			v.Outcome, v.Reason = Broken, fmt.Sprintf("tests newly failing in %s", strings.Join(newlyFailed, ", "))
+		case b.Passed:
+			v.Outcome, v.Reason = Broken, "go test fails after the changes"
+		}
+	}
+
+	return v
+}
+
+// StepOutcome is whether a step passed before and after the changes.
+type StepOutcome struct {
+	Name   string `json:"name"`
+	Before bool   `json:"before"`
+	After  bool   `json:"after"`
+}
+
+// Steps returns the outcomes of the steps run after the changes, in order.
+func (v *Verification) Steps() []StepOutcome {
+	var steps []StepOutcome
+	for _, a := range v.After.Steps {
+		b := v.Before.Step(a.Name)
+		steps = append(steps, StepOutcome{Name: a.Name, Before: b != nil && b.Passed, After: a.Passed})
+	}
+	return steps
+}
@@ -0,0 +1,28 @@
+package verify
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// nobody is the user and group running the sandboxed commands, in their user namespace
+const nobody = 65534
+
+// sandbox makes cmd run in new user, PID, IPC and UTS namespaces, as nobody: it has no capabilities, and it
+// can only write the files of the user running the process. Unless network is true, it also runs in a new
+// network namespace, without network access.
+func sandbox(cmd *exec.Cmd, network bool) {
+	flags := syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+	if !network {
+		flags |= syscall.CLONE_NEWNET
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:                 uintptr(flags),
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: nobody, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: nobody, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package verify
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// sandbox makes cmd fail: namespaces are only supported on Linux.
+func sandbox(cmd *exec.Cmd, network bool) {
+	cmd.Err = fmt.Errorf("sandbox not supported on %s", runtime.GOOS)
+}
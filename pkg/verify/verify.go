@@ -0,0 +1,323 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// StepBuild runs `go build ./...`
+	StepBuild = "build"
+	// StepVet runs `go vet ./...`
+	StepVet = "vet"
+	// StepTest runs `go test ./...`
+	StepTest = "test"
+
+	defaultTimeout   = 10 * time.Minute
+	defaultMaxOutput = 64 << 10
+)
+
+// Verifier runs the go tool in a module to check that it builds, passes vet and, optionally, its tests.
+//
+// Commands run offline: modules are only looked up in ModCache and GOPROXY, which is "off" unless set.
+// The repositories are untrusted: the commands get an environment of their own, without the variables of the
+// process, e.g. its tokens, and a temporary home directory. With Sandbox, they also run as an unprivileged user.
+type Verifier struct {
+	// Tests enables running `go test ./...`
+	Tests bool
+
+	// Timeout of each command, 10 minutes by default
+	Timeout time.Duration
+
+	// GoProxy is the GOPROXY used to resolve modules missing from the cache,
+	// e.g. a "file://" URL to a local proxy. Network access is disabled when empty.
+	GoProxy string
+
+	// ModCache is the module cache directory (GOMODCACHE), the user's one when empty
+	ModCache string
+
+	// BuildCache is the build cache directory (GOCACHE), a temporary one removed after each run when empty
+	BuildCache string
+
+	// Sandbox runs the commands in their own user, PID and network namespaces, as an unprivileged user.
+	// They have no network access, unless GoProxy needs it. Only supported on Linux.
+	Sandbox bool
+
+	// Parallelism limits the number of packages built and tested in parallel, and GOMAXPROCS
+	Parallelism int
+
+	// MemoryLimit is the soft memory limit of the go commands (GOMEMLIMIT), e.g. "2GiB"
+	MemoryLimit string
+
+	// MaxOutput is the number of bytes of each command output kept in the report, 64KiB by default
+	MaxOutput int
+}
+
+// Step is the result of a command.
+type Step struct {
+	Name     string
+	Passed   bool
+	TimedOut bool
+	Duration time.Duration
+
+	// Output is the combined output of the command, truncated to Verifier.MaxOutput bytes
+	Output string
+
+	// FailedPackages are the packages reported as failing by `go test`
+	FailedPackages []string
+}
+
+// Report contains the steps run in a module.
+type Report struct {
+	Steps []*Step
+}
+
+// Step returns the step named name, nil if it didn't run.
+func (r *Report) Step(name string) *Step {
+	for _, step := range r.Steps {
+		if step.Name == name {
+			return step
+		}
+	}
+	return nil
+}
+
+// Run builds, vets and optionally tests the module in dir. Steps after a failed build are not run.
+func (v *Verifier) Run(ctx context.Context, dir string) *Report {
+	report := &Report{}
+
+	home, err := ioutil.TempDir("", "contributehub-verify")
+	if err != nil {
+		report.Steps = append(report.Steps, &Step{Name: StepBuild, Output: fmt.Sprintf("error creating home directory: %v", err)})
+		return report
+	}
+	defer os.RemoveAll(home)
+
+	steps := []string{StepBuild, StepVet}
+	if v.Tests {
+		steps = append(steps, StepTest)
+	}
+
+	for _, name := range steps {
+		step := v.run(ctx, dir, home, name)
+		report.Steps = append(report.Steps, step)
+		if name == StepBuild && !step.Passed {
+			break
+		}
+	}
+
+	return report
+}
+
+func (v *Verifier) run(ctx context.Context, dir, home string, name string) *Step {
+	timeout := v.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := []string{name}
+	if v.Parallelism > 0 {
+		args = append(args, "-p", strconv.Itoa(v.Parallelism))
+	}
+	args = append(args, "./...")
+
+	maxOutput := v.MaxOutput
+	if maxOutput == 0 {
+		maxOutput = defaultMaxOutput
+	}
+	output := &limitedBuffer{max: maxOutput}
+	failed := &failedPackagesWriter{}
+
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = v.env(home)
+	if v.Sandbox {
+		sandbox(cmd, needsNetwork(v.GoProxy))
+	}
+	// The same writer is used for both outputs so that they are written by a single goroutine
+	w := io.MultiWriter(output, failed)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	// Don't wait for the children, e.g. test binaries, keeping the output open once the timeout killed go
+	cmd.WaitDelay = 5 * time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	step := &Step{
+		Name:     name,
+		Passed:   err == nil,
+		TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+		Duration: time.Since(start),
+		Output:   output.String(),
+	}
+	if err != nil && !step.TimedOut {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			step.Output += fmt.Sprintf("\nerror running go %s: %v", name, err)
+		}
+	}
+	if name == StepTest {
+		step.FailedPackages = failed.pkgs
+	}
+
+	return step
+}
+
+// env returns the environment of the go commands, with home as home directory. Only PATH is inherited
+// from the environment of the process: it holds credentials, e.g. the GitHub token.
+func (v *Verifier) env(home string) []string {
+	proxy := v.GoProxy
+	if proxy == "" {
+		proxy = "off"
+	}
+	modCache := v.ModCache
+	if modCache == "" {
+		modCache = userModCache()
+	}
+	buildCache := v.BuildCache
+	if buildCache == "" {
+		buildCache = filepath.Join(home, "cache")
+	}
+
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + home,
+		"TMPDIR=" + home,
+		"GOPATH=" + filepath.Join(home, "go"),
+		"GOCACHE=" + buildCache,
+		"GOMODCACHE=" + modCache,
+		// The go env file of the user is ignored, it may also hold credentials, e.g. GOAUTH
+		"GOENV=off",
+		"GOFLAGS=-mod=mod",
+		"GOPROXY=" + proxy,
+		"GOSUMDB=off",
+		"GOTOOLCHAIN=local",
+		"GOWORK=off",
+	}
+	if v.Parallelism > 0 {
+		env = append(env, "GOMAXPROCS="+strconv.Itoa(v.Parallelism))
+	}
+	if v.MemoryLimit != "" {
+		env = append(env, "GOMEMLIMIT="+v.MemoryLimit)
+	}
+
+	return env
+}
+
+// userModCache returns the module cache of the user running the process.
+func userModCache() string {
+	if modCache := os.Getenv("GOMODCACHE"); modCache != "" {
+		return modCache
+	}
+	return filepath.Join(filepath.SplitList(build.Default.GOPATH)[0], "pkg", "mod")
+}
+
+// needsNetwork returns whether the GOPROXY proxy downloads modules from the network.
+func needsNetwork(proxy string) bool {
+	for _, entry := range strings.FieldsFunc(proxy, func(r rune) bool { return r == ',' || r == '|' }) {
+		if entry != "off" && !strings.HasPrefix(entry, "file:") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckSandbox returns an error if the commands can't run in a sandbox, e.g. when the user namespaces
+// are disabled.
+func CheckSandbox() error {
+	cmd := exec.Command("go", "version")
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "GOTOOLCHAIN=local"}
+	sandbox(cmd, false)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error running go in a sandbox: %v %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// ValidateGoProxy returns an error if proxy is not a valid GOPROXY: a list, separated by commas or pipes,
+// of "off", "direct" or http, https or file URLs.
+func ValidateGoProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+
+	for _, entry := range strings.FieldsFunc(proxy, func(r rune) bool { return r == ',' || r == '|' }) {
+		if entry == "off" || entry == "direct" {
+			continue
+		}
+		u, err := url.Parse(entry)
+		if err != nil {
+			return fmt.Errorf("invalid proxy %q: %v", entry, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "file" {
+			return fmt.Errorf("invalid proxy %q, expecting off, direct or an http, https or file URL", entry)
+		}
+	}
+	return nil
+}
+
+// failedPackagesWriter records the packages of the `FAIL\t<package>...` lines of go test output.
+// The whole output is scanned, even if the output kept in the report is truncated.
+type failedPackagesWriter struct {
+	line []byte
+	pkgs []string
+}
+
+func (w *failedPackagesWriter) Write(p []byte) (int, error) {
+	w.line = append(w.line, p...)
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := string(w.line[:i])
+		w.line = w.line[i+1:]
+		if !strings.HasPrefix(line, "FAIL\t") {
+			continue
+		}
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			w.pkgs = append(w.pkgs, fields[1])
+		}
+	}
+	return len(p), nil
+}
+
+// limitedBuffer keeps the first max bytes written to it.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if left := b.max - b.buf.Len(); left < len(p) {
+		b.truncated = true
+		if left > 0 {
+			b.buf.Write(p[:left])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
@@ -0,0 +1,251 @@
+package verify
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// buildCache returns the build cache of the user, the tests don't build the standard library again.
+func buildCache(t *testing.T) string {
+	out, err := exec.Command("go", "env", "GOCACHE").Output()
+	if err != nil {
+		t.Skip("go not found")
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestCompare(t *testing.T) {
+	passed := func(name string) *Step {
+		return &Step{Name: name, Passed: true}
+	}
+	failed := func(name string, pkgs ...string) *Step {
+		return &Step{Name: name, FailedPackages: pkgs}
+	}
+
+	tt := map[string]struct {
+		Before   []*Step
+		After    []*Step
+		Expected Outcome
+	}{
+		"passed": {
+			Before:   []*Step{passed(StepBuild), passed(StepVet), passed(StepTest)},
+			After:    []*Step{passed(StepBuild), passed(StepVet), passed(StepTest)},
+			Expected: Passed,
+		},
+		"no-tests": {
+			Before:   []*Step{passed(StepBuild), passed(StepVet)},
+			After:    []*Step{passed(StepBuild), passed(StepVet)},
+			Expected: Passed,
+		},
+		"build-broken": {
+			Before:   []*Step{passed(StepBuild), passed(StepVet)},
+			After:    []*Step{failed(StepBuild)},
+			Expected: Broken,
+		},
+		"vet-broken": {
+			Before:   []*Step{passed(StepBuild), passed(StepVet)},
+			After:    []*Step{passed(StepBuild), failed(StepVet)},
+			Expected: Broken,
+		},
+		"build-failing-before": {
+			Before:   []*Step{failed(StepBuild)},
+			After:    []*Step{failed(StepBuild)},
+			Expected: Unverifiable,
+		},
+		"same-tests-failing": {
+			Before:   []*Step{passed(StepBuild), passed(StepVet), failed(StepTest, "a")},
+			After:    []*Step{passed(StepBuild), passed(StepVet), failed(StepTest, "a")},
+			Expected: Passed,
+		},
+		"tests-newly-failing": {
+			Before:   []*Step{passed(StepBuild), passed(StepVet), failed(StepTest, "a")},
+			After:    []*Step{passed(StepBuild), passed(StepVet), failed(StepTest, "a", "b")},
+			Expected: Broken,
+		},
+		"tests-failing": {
+			Before:   []*Step{passed(StepBuild), passed(StepVet), passed(StepTest)},
+			After:    []*Step{passed(StepBuild), passed(StepVet), failed(StepTest)},
+			Expected: Broken,
+		},
+		"tests-timeout-before": {
+			Before:   []*Step{passed(StepBuild), passed(StepVet), {Name: StepTest, TimedOut: true}},
+			After:    []*Step{passed(StepBuild), passed(StepVet), passed(StepTest)},
+			Expected: Unverifiable,
+		},
+	}
+
+	for name, tc := range tt {
+		v := Compare(&Report{Steps: tc.Before}, &Report{Steps: tc.After})
+		assert.Equal(t, tc.Expected, v.Outcome, name)
+		if tc.Expected != Passed {
+			assert.NotEmpty(t, v.Reason, name)
+		}
+	}
+}
+
+func TestVerificationSteps(t *testing.T) {
+	before := &Report{Steps: []*Step{{Name: StepBuild, Passed: true}, {Name: StepVet, Passed: true}, {Name: StepTest}}}
+	after := &Report{Steps: []*Step{{Name: StepBuild, Passed: true}, {Name: StepVet, Passed: true}, {Name: StepTest}}}
+
+	assert.Equal(t, []StepOutcome{
+		{Name: StepBuild, Before: true, After: true},
+		{Name: StepVet, Before: true, After: true},
+		{Name: StepTest},
+	}, Compare(before, after).Steps())
+}
+
+func TestVerifierRun(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+
+	dir, err := ioutil.TempDir("", "verify")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"go.mod":       "module example.com/m\n\ngo 1.13\n",
+		"a/a.go":       "package a\n\nfunc A() int { return 1 }\n",
+		"a/a_test.go":  "package a\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) {\n\tif A() != 1 {\n\t\tt.Fail()\n\t}\n}\n",
+		"b/b.go":       "package b\n",
+		"b/b_test.go":  "package b\n\nimport \"testing\"\n\nfunc TestB(t *testing.T) { t.Fail() }\n",
+		"main/main.go": "package main\n\nimport \"example.com/m/a\"\n\nfunc main() { _ = a.A() }\n",
+	}
+	for filename, content := range files {
+		path := filepath.Join(dir, filename)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	verifier := &Verifier{Tests: true, Parallelism: 1, BuildCache: buildCache(t)}
+	before := verifier.Run(context.Background(), dir)
+	assert.True(t, before.Step(StepBuild).Passed, before.Step(StepBuild).Output)
+	assert.True(t, before.Step(StepVet).Passed, before.Step(StepVet).Output)
+	assert.Equal(t, []string{"example.com/m/b"}, before.Step(StepTest).FailedPackages)
+
+	// Break package a test
+	err = ioutil.WriteFile(filepath.Join(dir, "a/a.go"), []byte("package a\n\nfunc A() int { return 2 }\n"), 0644)
+	assert.NoError(t, err)
+
+	after := verifier.Run(context.Background(), dir)
+	v := Compare(before, after)
+	assert.Equal(t, Broken, v.Outcome)
+	assert.Contains(t, v.Reason, "example.com/m/a")
+
+	// Break the build
+	err = ioutil.WriteFile(filepath.Join(dir, "a/a.go"), []byte("package a\n\nfunc A() int { return \"\" }\n"), 0644)
+	assert.NoError(t, err)
+
+	after = verifier.Run(context.Background(), dir)
+	assert.Len(t, after.Steps, 1)
+	v = Compare(before, after)
+	assert.Equal(t, Broken, v.Outcome)
+	assert.Contains(t, v.Reason, "build")
+}
+
+func TestVerifierGoProxy(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/m\n\ngo 1.13\n\nrequire example.com/dep v1.0.0\n",
+		"main.go": "package main\n\nimport _ \"example.com/dep\"\n\nfunc main() {}\n",
+	}
+	for filename, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, filename), []byte(content), 0644))
+	}
+
+	// The module is looked up in the proxy, which is empty
+	proxy := filepath.Join(t.TempDir(), "proxy")
+	verifier := &Verifier{GoProxy: "file://" + filepath.ToSlash(proxy), ModCache: t.TempDir(), BuildCache: buildCache(t)}
+	report := verifier.Run(context.Background(), dir)
+	build := report.Step(StepBuild)
+	assert.False(t, build.Passed)
+	assert.Contains(t, build.Output, filepath.ToSlash(proxy))
+
+	verifier.GoProxy = ""
+	report = verifier.Run(context.Background(), dir)
+	assert.Contains(t, report.Step(StepBuild).Output, "GOPROXY=off")
+}
+
+func TestValidateGoProxy(t *testing.T) {
+	for _, proxy := range []string{"", "off", "https://proxy.golang.org,direct", "file:///srv/goproxy|off"} {
+		assert.NoError(t, ValidateGoProxy(proxy), proxy)
+	}
+	for _, proxy := range []string{"proxy.golang.org", "ftp://proxy", "https://proxy,%zz"} {
+		assert.Error(t, ValidateGoProxy(proxy), proxy)
+	}
+}
+
+func TestVerifierEnv(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "secret")
+	t.Setenv("CONTRIBUTEHUB_GITHUB_TOKEN", "secret")
+	t.Setenv("GOFLAGS", "-tags=secret")
+
+	verifier := &Verifier{ModCache: "/modcache", BuildCache: "/cache"}
+	env := verifier.env("/home")
+	for _, v := range env {
+		assert.NotContains(t, v, "secret")
+	}
+	assert.Contains(t, env, "HOME=/home")
+	assert.Contains(t, env, "GOMODCACHE=/modcache")
+	assert.Contains(t, env, "GOCACHE=/cache")
+	assert.Contains(t, env, "GOPROXY=off")
+}
+
+func TestVerifierSandbox(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+	if err := CheckSandbox(); err != nil {
+		t.Skip(err)
+	}
+	t.Setenv("GITHUB_TOKEN", "secret")
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.13\n",
+		"a_test.go": `package a
+
+import (
+	"net"
+	"os"
+	"testing"
+)
+
+func TestSandbox(t *testing.T) {
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		t.Errorf("GITHUB_TOKEN=%s", token)
+	}
+	if uid := os.Getuid(); uid != 65534 {
+		t.Errorf("running as %d", uid)
+	}
+	if conn, err := net.Dial("tcp", "1.1.1.1:443"); err == nil {
+		conn.Close()
+		t.Error("network access")
+	}
+}
+`,
+	}
+	for filename, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, filename), []byte(content), 0644))
+	}
+
+	verifier := &Verifier{Tests: true, Sandbox: true, BuildCache: buildCache(t)}
+	report := verifier.Run(context.Background(), dir)
+	test := report.Step(StepTest)
+	if assert.NotNil(t, test, report.Step(StepBuild).Output) {
+		assert.True(t, test.Passed, test.Output)
+	}
+}